@@ -18,6 +18,7 @@ const (
 	api_LIST apiOps = iota
 	api_QUERY
 	API_TOKEN
+	api_BOOKMARK
 )
 
 type D1RespMessage struct {
@@ -46,7 +47,10 @@ type D1RespQueryResultMeta struct {
 	RowsRead    int64   `json:"rows_read"`
 	RowsWritten int64   `json:"rows_written"`
 	ServedBy    string  `json:"served_by"`
-	SizeAfter   int64   `json:"size_after"`
+	// ServedByPrimary and ServedByRegion are reported with read replication.
+	ServedByPrimary bool   `json:"served_by_primary"`
+	ServedByRegion  string `json:"served_by_region"`
+	SizeAfter       int64  `json:"size_after"`
 }
 
 type D1RespQueryResults struct {
@@ -66,6 +70,7 @@ type D1Resp struct {
 	ResultInfo *D1RespResultInfo    `json:"result_info"`
 	Success    bool                 `json:"success"`
 	AuditlogId string               `json:"-"`
+	Bookmark   string               `json:"-"`
 }
 
 type ParameterizedStatement struct {
@@ -81,12 +86,14 @@ func (c *Connection) apiOpsToEndpoint(apiOps apiOps, account string) string {
 		return "/accounts/" + account + "/d1/database/" + c.databaseId + "/raw"
 	case API_TOKEN:
 		return "/user/tokens/verify"
+	case api_BOOKMARK:
+		return "/accounts/" + account + "/d1/database/" + c.databaseId + "/time_travel/bookmark"
 	default:
 		return ""
 	}
 }
 
-func (c *Connection) d1ApiCall(ctx context.Context, apiOps apiOps, method string, reqBody []byte) (respBody []byte, auditlogId string, duration time.Duration, err error) {
+func (c *Connection) d1ApiCall(ctx context.Context, apiOps apiOps, method string, reqBody []byte, session *Session) (respBody []byte, auditlogId string, duration time.Duration, err error) {
 	var endpoint = c.apiOpsToEndpoint(apiOps, c.accountId)
 	if endpoint == "" {
 		err = ErrInvalidAPI
@@ -105,8 +112,42 @@ func (c *Connection) d1ApiCall(ctx context.Context, apiOps apiOps, method string
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiToken))
+	if session != nil {
+		req.Header.Set(sessionBookmarkHeader, session.headerValue())
+	}
+
+	// sent tells the breaker whether the api was called at all
+	var sent bool
+	if c.breaker != nil {
+		var permit breakerPermit
+		if permit, err = c.breaker.allow(); err != nil {
+			Trace("%s: circuit breaker rejected call: %s", c.ID, err)
+			return
+		}
+		var outcome = breakerIgnored
+		defer func() { c.breaker.done(permit, outcome) }()
+		defer func() {
+			switch {
+			case err == nil:
+				outcome = breakerSuccess
+			case isApiFailure(ctx, err, sent):
+				outcome = breakerFailure
+			}
+		}()
+	}
+
+	if c.limiter != nil {
+		var release func()
+		release, err = c.limiter.wait(ctx)
+		if err != nil {
+			Trace("%s: rate limiter wait failed: %s", c.ID, err)
+			return
+		}
+		defer release()
+	}
 
 	var start = time.Now()
+	sent = true
 	resp, err := c.client.Do(req)
 	if err != nil {
 		duration = time.Since(start)
@@ -114,6 +155,9 @@ func (c *Connection) d1ApiCall(ctx context.Context, apiOps apiOps, method string
 		return
 	}
 	auditlogId = resp.Header.Get("cf-auditlog-id")
+	if session != nil {
+		session.update(resp.Header.Get(sessionBookmarkHeader))
+	}
 	duration = time.Since(start)
 	defer resp.Body.Close()
 
@@ -124,7 +168,7 @@ func (c *Connection) d1ApiCall(ctx context.Context, apiOps apiOps, method string
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("http status: %d, body: %s", resp.StatusCode, respBody)
+		err = &httpStatusError{StatusCode: resp.StatusCode, Body: respBody}
 		Trace("%s: client.Do(%d) failed: %s", c.ID, resp.StatusCode, err)
 		return
 	}
@@ -134,36 +178,175 @@ func (c *Connection) d1ApiCall(ctx context.Context, apiOps apiOps, method string
 	return
 }
 
+// APIError is returned when the api reports errors, e.g. a statement
+// violating a constraint.
+type APIError struct {
+	StatusCode int
+	Errors     []D1RespError
+}
+
+func (e *APIError) Error() string {
+	var errs = []string{}
+	for idx, e := range e.Errors {
+		errs = append(errs, fmt.Sprintf("[%d] code: %d, message: '%s'", idx, e.Code, e.Message))
+	}
+	return strings.Join(errs, "\n")
+}
+
+// httpStatusError is returned by d1ApiCall for non 200 responses.
+type httpStatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("http status: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// isApiFailure reports whether err means the api is unhealthy, as opposed
+// to a rejected request or a caller giving up. A deadline expiring once
+// the request was sent means the api was too slow.
+func isApiFailure(ctx context.Context, err error, sent bool) bool {
+	switch ctxErr := ctx.Err(); {
+	case errors.Is(ctxErr, context.Canceled):
+		return false
+	case errors.Is(ctxErr, context.DeadlineExceeded):
+		return sent
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError ||
+			statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+type batchStatements struct {
+	Batch []ParameterizedStatement `json:"batch"`
+}
+
 func (c *Connection) WriteParameterizedContext(ctx context.Context, stmt ParameterizedStatement) (resp D1Resp, err error) {
+	if err = c.beforeWrite(ctx); err != nil {
+		return c.closedResp(err), err
+	}
+
+	Trace("%s: Write() for %d statement args", c.ID, len(stmt.Params))
+	if err = c.convertParams(stmt.Params); err != nil {
+		return
+	}
+
+	if err = c.limits.check(stmt); err != nil {
+		if !c.splitInserts {
+			Trace("%s: statement rejected: %s", c.ID, err)
+			return
+		}
+		stmts, splitErr := c.limits.splitInsert(stmt)
+		if splitErr != nil {
+			Trace("%s: statement rejected: %s, split failed: %s", c.ID, err, splitErr)
+			return
+		}
+		Trace("%s: statement split into %d statements", c.ID, len(stmts))
+
+		resp, err = c.write(ctx, batchStatements{Batch: stmts})
+		if err != nil {
+			return
+		}
+		return mergeResults(resp), nil
+	}
+
+	return c.write(ctx, stmt)
+}
+
+// WriteBatchContext sends the statements as one batch, D1 executes them
+// in a single transaction and returns one result per statement.
+func (c *Connection) WriteBatchContext(ctx context.Context, stmts []ParameterizedStatement) (resp D1Resp, err error) {
+	if err = c.beforeWrite(ctx); err != nil {
+		return c.closedResp(err), err
+	}
+
+	Trace("%s: WriteBatch() for %d statements", c.ID, len(stmts))
+	for _, stmt := range stmts {
+		if err = c.convertParams(stmt.Params); err != nil {
+			return
+		}
+		if err = c.limits.check(stmt); err != nil {
+			Trace("%s: statement rejected: %s", c.ID, err)
+			return
+		}
+	}
+
+	return c.write(ctx, batchStatements{Batch: stmts})
+}
+
+func (c *Connection) beforeWrite(ctx context.Context) error {
 	if c.hasBeenClosed {
-		var errResult D1Resp
+		return ErrClosed
+	}
+
+	if err := c.ensureVerified(ctx); err != nil {
+		Trace("%s: api token verification failed: %s", c.ID, err)
+		return err
+	}
+	return nil
+}
+
+func (c *Connection) closedResp(err error) (errResult D1Resp) {
+	if err == ErrClosed {
 		errResult.Success = false
 		errResult.Errors = append(errResult.Errors, D1RespError{Code: 0, Message: "Connection has been closed"})
-		return errResult, ErrClosed
 	}
+	return
+}
 
-	Trace("%s: Write() for %d statement args", c.ID, len(stmt.Params))
-
-	for idx, param := range stmt.Params {
+func (c *Connection) convertParams(params []interface{}) (err error) {
+	for idx, param := range params {
 		Trace("%s: param[%d]: %v", c.ID, idx, param)
 		switch param := param.(type) {
+		case bool:
+			// stored as INTEGER 0/1 like SQLite does, not as JSON true/false
+			if param {
+				params[idx] = int64(1)
+			} else {
+				params[idx] = int64(0)
+			}
 		case time.Time:
-			stmt.Params[idx] = param.Format(time.RFC3339Nano)
+			params[idx] = param.Format(c.TimeFormat())
 		case []byte:
-			stmt.Params[idx] = BytesToUnicodeEscapes(param)
+			params[idx] = BytesToUnicodeEscapes(param)
+		default:
+			if isComposite(param) {
+				params[idx], err = marshalComposite(param)
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
+	return nil
+}
 
-	reqBody, err := json.Marshal(stmt)
+func (c *Connection) write(ctx context.Context, body interface{}) (resp D1Resp, err error) {
+	reqBody, err := json.Marshal(body)
 	if err != nil {
 		Trace("%s: reqBody json.Marshal() failed: %s", c.ID, err)
 		return
 	}
 	Trace("%s, reqBody: %s", c.ID, reqBody)
 
-	respBody, auditlogId, duration, err := c.d1ApiCall(ctx, api_QUERY, "POST", reqBody)
+	session := c.sessionFor(ctx)
+	respBody, auditlogId, duration, err := c.d1ApiCall(ctx, api_QUERY, "POST", reqBody, session)
 	if err != nil {
 		Trace("%s: d1ApiCall() failed: %s, duration: %s", c.ID, err, duration)
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) {
+			// statement errors come with a 4xx status and the usual body
+			var errResp D1Resp
+			if json.Unmarshal(statusErr.Body, &errResp) == nil && len(errResp.Errors) > 0 {
+				errResp.AuditlogId = auditlogId
+				err = &APIError{StatusCode: statusErr.StatusCode, Errors: errResp.Errors}
+				return errResp, err
+			}
+		}
 		return
 	}
 	Trace("%s: d1ApiCall() OK, duration: %s", c.ID, duration)
@@ -175,14 +358,13 @@ func (c *Connection) WriteParameterizedContext(ctx context.Context, stmt Paramet
 		return
 	}
 	resp.AuditlogId = auditlogId
+	if session != nil {
+		resp.Bookmark = session.Bookmark()
+	}
 	Trace("%s: resp json.Unmarshal() OK", c.ID)
 
 	if !resp.Success {
-		var errs = []string{}
-		for idx, e := range resp.Errors {
-			errs = append(errs, fmt.Sprintf("[%d] code: %d, message: '%s'", idx, e.Code, e.Message))
-		}
-		err = errors.New(strings.Join(errs, "\n"))
+		err = &APIError{StatusCode: http.StatusOK, Errors: resp.Errors}
 		Trace("%s: api call failed, err: %s, %+v", c.ID, err, resp)
 		return
 	}
@@ -190,6 +372,33 @@ func (c *Connection) WriteParameterizedContext(ctx context.Context, stmt Paramet
 	return
 }
 
+// mergeResults folds the results of a split statement into a single one,
+// as if the statement had been executed unsplit.
+func mergeResults(resp D1Resp) D1Resp {
+	if len(resp.Result) < 2 {
+		return resp
+	}
+
+	merged := &D1RespQueryResult{}
+	for _, result := range resp.Result {
+		merged.Meta.ChangedDb = merged.Meta.ChangedDb || result.Meta.ChangedDb
+		merged.Meta.Changes += result.Meta.Changes
+		merged.Meta.Duration += result.Meta.Duration
+		merged.Meta.RowsRead += result.Meta.RowsRead
+		merged.Meta.RowsWritten += result.Meta.RowsWritten
+		merged.Meta.LastRowID = result.Meta.LastRowID
+		merged.Meta.ServedBy = result.Meta.ServedBy
+		merged.Meta.ServedByPrimary = result.Meta.ServedByPrimary
+		merged.Meta.ServedByRegion = result.Meta.ServedByRegion
+		merged.Meta.SizeAfter = result.Meta.SizeAfter
+
+		merged.Results.Columns = result.Results.Columns
+		merged.Results.Rows = append(merged.Results.Rows, result.Results.Rows...)
+	}
+	resp.Result = []*D1RespQueryResult{merged}
+	return resp
+}
+
 func (c *Connection) VerifyApiTokenContext(ctx context.Context) (err error) {
 	if c.hasBeenClosed {
 		return ErrClosed
@@ -197,7 +406,7 @@ func (c *Connection) VerifyApiTokenContext(ctx context.Context) (err error) {
 
 	Trace("%s: VerifyApiToken()", c.ID)
 
-	_, auditlogId, duration, err := c.d1ApiCall(ctx, API_TOKEN, "GET", nil)
+	_, auditlogId, duration, err := c.d1ApiCall(ctx, API_TOKEN, "GET", nil, nil)
 	if err != nil {
 		Trace("%s: d1ApiCall() failed: %s, duration: %s", c.ID, err, duration)
 		return
@@ -205,3 +414,35 @@ func (c *Connection) VerifyApiTokenContext(ctx context.Context) (err error) {
 	Trace("%s: d1ApiCall() OK, duration: %s, auditlogId: %s", c.ID, duration, auditlogId)
 	return
 }
+
+// TimeTravelBookmarkContext returns the current time travel bookmark of the
+// database, which it can be restored to with
+// `wrangler d1 time-travel restore --bookmark`.
+func (c *Connection) TimeTravelBookmarkContext(ctx context.Context) (bookmark string, err error) {
+	if c.hasBeenClosed {
+		return "", ErrClosed
+	}
+
+	respBody, auditlogId, duration, err := c.d1ApiCall(ctx, api_BOOKMARK, "GET", nil, nil)
+	if err != nil {
+		Trace("%s: d1ApiCall() failed: %s, duration: %s", c.ID, err, duration)
+		return
+	}
+
+	var resp struct {
+		Errors []D1RespError `json:"errors"`
+		Result struct {
+			Bookmark string `json:"bookmark"`
+		} `json:"result"`
+		Success bool `json:"success"`
+	}
+	if err = json.Unmarshal(respBody, &resp); err != nil {
+		Trace("%s: json.Unmarshal() failed: %s", c.ID, err)
+		return
+	}
+	if !resp.Success {
+		return "", &APIError{StatusCode: http.StatusOK, Errors: resp.Errors}
+	}
+	Trace("%s: d1ApiCall() OK, duration: %s, auditlogId: %s, bookmark: %s", c.ID, duration, auditlogId, resp.Result.Bookmark)
+	return resp.Result.Bookmark, nil
+}
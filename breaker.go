@@ -0,0 +1,235 @@
+package d1
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of the circuit breaker around the D1 api.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every api call through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails api calls fast with ErrCircuitOpen.
+	BreakerOpen
+	// BreakerHalfOpen lets a few probing api calls through to decide
+	// whether the api has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	defaultBreakerMinRequests    = 10
+	defaultBreakerWindowSecond   = 60
+	defaultBreakerCooldownSecond = 30
+	defaultBreakerProbes         = 1
+)
+
+type breakerOutcome int
+
+const (
+	breakerSuccess breakerOutcome = iota
+	breakerFailure
+	// breakerIgnored releases a permit without counting the call, e.g.
+	// when the caller gave up before the request was sent.
+	breakerIgnored
+)
+
+// circuitBreaker opens once the failure ratio of api calls within a window
+// exceeds the configured ratio. It's shared by every Connection using the
+// same account, like the accountLimiter.
+type circuitBreaker struct {
+	accountId   string
+	ratio       float64
+	minRequests int
+	window      time.Duration
+	cooldown    time.Duration
+	probes      int
+
+	mu             sync.Mutex
+	state          BreakerState
+	windowStart    time.Time
+	requests       int
+	failures       int
+	openedAt       time.Time
+	probing        int
+	probeSuccesses int
+	// generation counts the state changes, see breakerPermit.
+	generation uint64
+}
+
+var accountBreakers = struct {
+	mu sync.Mutex
+	m  map[string]*circuitBreaker
+}{m: map[string]*circuitBreaker{}}
+
+// breakerFor returns the circuit breaker of the account, creating it with
+// the given settings. The first Connection of an account decides them,
+// other settings for the same account are rejected.
+func breakerFor(accountId string, ratio float64, minRequests int, window, cooldown time.Duration, probes int) (*circuitBreaker, error) {
+	accountBreakers.mu.Lock()
+	defer accountBreakers.mu.Unlock()
+
+	if b, ok := accountBreakers.m[accountId]; ok {
+		if b.ratio != ratio || b.minRequests != minRequests || b.window != window || b.cooldown != cooldown || b.probes != probes {
+			return nil, fmt.Errorf("invalid breaker_ratio specified: account %s already has a breaker with breaker_ratio=%v, breaker_min_requests=%d, breaker_window=%v, breaker_cooldown=%v, breaker_probes=%d",
+				accountId, b.ratio, b.minRequests, int(b.window/time.Second), int(b.cooldown/time.Second), b.probes)
+		}
+		return b, nil
+	}
+
+	b := &circuitBreaker{
+		accountId:   accountId,
+		ratio:       ratio,
+		minRequests: minRequests,
+		window:      window,
+		cooldown:    cooldown,
+		probes:      probes,
+		windowStart: time.Now(),
+	}
+	accountBreakers.m[accountId] = b
+	return b, nil
+}
+
+// State returns the current state of the breaker.
+func (b *circuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerPermit is handed out by allow for every api call let through, it
+// ties the outcome reported by done to the state the call was allowed in.
+type breakerPermit struct {
+	state      BreakerState
+	generation uint64
+}
+
+// breakerChange is a state change, reported to the hooks once b.mu is
+// released so they may use the breaker.
+type breakerChange struct {
+	from, to BreakerState
+}
+
+// setState must be called with b.mu held, the returned change has to be
+// passed to notify after releasing it.
+func (b *circuitBreaker) setState(to BreakerState) *breakerChange {
+	from := b.state
+	if from == to {
+		return nil
+	}
+	b.state = to
+	b.generation++
+	b.windowStart = time.Now()
+	b.requests, b.failures = 0, 0
+	b.probing, b.probeSuccesses = 0, 0
+	if to == BreakerOpen {
+		b.openedAt = time.Now()
+	}
+	Trace("circuit breaker of account %s: %s -> %s", b.accountId, from, to)
+	return &breakerChange{from: from, to: to}
+}
+
+func (b *circuitBreaker) notify(change *breakerChange) {
+	if change == nil {
+		return
+	}
+	if h := getHooks(); h.OnBreakerStateChange != nil {
+		h.OnBreakerStateChange(b.accountId, change.from, change.to)
+	}
+}
+
+// allow reports whether an api call may be sent, every allowed call must
+// be reported back by done with the returned permit.
+func (b *circuitBreaker) allow() (permit breakerPermit, err error) {
+	var change *breakerChange
+	b.mu.Lock()
+	defer func() {
+		b.mu.Unlock()
+		b.notify(change)
+	}()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return permit, ErrCircuitOpen
+		}
+		change = b.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing >= b.probes {
+			return permit, ErrCircuitOpen
+		}
+		b.probing++
+	default:
+		if time.Since(b.windowStart) > b.window {
+			b.windowStart = time.Now()
+			b.requests, b.failures = 0, 0
+		}
+	}
+	return breakerPermit{state: b.state, generation: b.generation}, nil
+}
+
+// done reports the outcome of a call allowed with permit. Outcomes of calls
+// allowed before the last state change are stale and ignored, e.g. a call
+// allowed while closed finishing once the breaker is half-open is no probe.
+func (b *circuitBreaker) done(permit breakerPermit, outcome breakerOutcome) {
+	var change *breakerChange
+	b.mu.Lock()
+	defer func() {
+		b.mu.Unlock()
+		b.notify(change)
+	}()
+
+	if permit.generation != b.generation {
+		return
+	}
+
+	if b.state == BreakerHalfOpen {
+		b.probing--
+		switch outcome {
+		case breakerFailure:
+			change = b.setState(BreakerOpen)
+		case breakerSuccess:
+			b.probeSuccesses++
+			if b.probeSuccesses >= b.probes {
+				change = b.setState(BreakerClosed)
+			}
+		}
+		return
+	}
+	if b.state != BreakerClosed || outcome == breakerIgnored {
+		return
+	}
+
+	b.requests++
+	if outcome == breakerFailure {
+		b.failures++
+	}
+	if b.requests >= b.minRequests && float64(b.failures)/float64(b.requests) >= b.ratio {
+		change = b.setState(BreakerOpen)
+	}
+}
+
+// BreakerState returns the state of the circuit breaker the connection
+// uses, it's always BreakerClosed when the breaker is not enabled.
+func (c *Connection) BreakerState() BreakerState {
+	if c.breaker == nil {
+		return BreakerClosed
+	}
+	return c.breaker.State()
+}
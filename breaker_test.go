@@ -0,0 +1,116 @@
+package d1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var transitions []string
+	SetHooks(Hooks{OnBreakerStateChange: func(accountId string, from, to BreakerState) {
+		transitions = append(transitions, from.String()+">"+to.String())
+	}})
+	defer SetHooks(Hooks{})
+
+	b, err := breakerFor("breaker-account", 0.5, 4, time.Minute, 20*time.Millisecond, 1)
+	if !assert.Nil(t, err) {
+		return
+	}
+	shared, err := breakerFor("breaker-account", 0.5, 4, time.Minute, 20*time.Millisecond, 1)
+	assert.Nil(t, err)
+	assert.Same(t, b, shared, "shared by the account")
+	_, err = breakerFor("breaker-account", 0.9, 4, time.Minute, 20*time.Millisecond, 1)
+	assert.NotNil(t, err, "conflicting settings")
+
+	for _, outcome := range []breakerOutcome{breakerSuccess, breakerFailure, breakerSuccess} {
+		permit, err := b.allow()
+		assert.Nil(t, err)
+		b.done(permit, outcome)
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+
+	permit, err := b.allow()
+	assert.Nil(t, err)
+	b.done(permit, breakerFailure)
+	assert.Equal(t, BreakerOpen, b.State())
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	time.Sleep(30 * time.Millisecond)
+	permit, err = b.allow()
+	assert.Nil(t, err, "half-open probe")
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "only one probe at a time")
+	b.done(permit, breakerFailure)
+	assert.Equal(t, BreakerOpen, b.State())
+
+	time.Sleep(30 * time.Millisecond)
+	permit, err = b.allow()
+	assert.Nil(t, err)
+	b.done(permit, breakerSuccess)
+	assert.Equal(t, BreakerClosed, b.State())
+
+	assert.Equal(t, []string{
+		"closed>open", "open>half-open", "half-open>open",
+		"open>half-open", "half-open>closed",
+	}, transitions)
+}
+
+func TestCircuitBreakerStaleCalls(t *testing.T) {
+	b, err := breakerFor("breaker-stale-account", 0.5, 2, time.Minute, 20*time.Millisecond, 1)
+	if !assert.Nil(t, err) {
+		return
+	}
+	// a hook using the breaker must not deadlock
+	SetHooks(Hooks{OnBreakerStateChange: func(accountId string, from, to BreakerState) {
+		b.State()
+	}})
+	defer SetHooks(Hooks{})
+
+	late, err := b.allow()
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		permit, err := b.allow()
+		assert.Nil(t, err)
+		b.done(permit, breakerFailure)
+	}
+	assert.Equal(t, BreakerOpen, b.State())
+
+	time.Sleep(30 * time.Millisecond)
+	probe, err := b.allow()
+	assert.Nil(t, err, "half-open probe")
+	assert.Equal(t, BreakerHalfOpen, b.State())
+
+	// a call allowed while closed finishes during the probe
+	b.done(late, breakerSuccess)
+	assert.Equal(t, BreakerHalfOpen, b.State(), "stale success doesn't close")
+	b.done(late, breakerFailure)
+	assert.Equal(t, BreakerHalfOpen, b.State(), "stale failure doesn't open")
+	_, err = b.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "probe still in flight")
+
+	b.done(probe, breakerSuccess)
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestIsApiFailure(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, isApiFailure(ctx, errors.New("connection reset"), true))
+	assert.True(t, isApiFailure(ctx, &httpStatusError{StatusCode: http.StatusBadGateway}, true))
+	assert.True(t, isApiFailure(ctx, &httpStatusError{StatusCode: http.StatusTooManyRequests}, true))
+	assert.False(t, isApiFailure(ctx, &httpStatusError{StatusCode: http.StatusBadRequest}, true))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, isApiFailure(canceled, context.Canceled, true), "cancelled by the caller")
+
+	expired, cancel := context.WithTimeout(ctx, 0)
+	defer cancel()
+	assert.True(t, isApiFailure(expired, context.DeadlineExceeded, true), "api too slow")
+	assert.False(t, isApiFailure(expired, context.DeadlineExceeded, false), "expired before sending")
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,6 +28,21 @@ type Connection struct {
 	hasBeenClosed bool   //   false
 	ID            string //   generated in init()
 	client        http.Client
+
+	verifyMode VerifyMode
+	verifyTTL  time.Duration
+	verifyMu   sync.Mutex
+	verified   bool
+
+	session *Session
+	limiter *accountLimiter
+	breaker *circuitBreaker
+
+	limits       Limits
+	splitInserts bool
+
+	txMode     TransactionMode
+	timeFormat string
 }
 
 // Close will mark the connection as closed. It is safe to be called
@@ -91,6 +107,118 @@ func (conn *Connection) init(dsn string) error {
 		timeout = customTimeout
 	}
 
+	conn.verifyMode, err = parseVerifyMode(query.Get("verify"))
+	if err != nil {
+		return err
+	}
+
+	verifyTTL := defaultVerifyTTLSecond
+	if query.Get("verify_ttl") != "" {
+		customTTL, err := strconv.Atoi(query.Get("verify_ttl"))
+		if err != nil {
+			return errors.New("invalid verify_ttl specified: " + err.Error())
+		}
+		verifyTTL = customTTL
+	}
+	conn.verifyTTL = time.Second * time.Duration(verifyTTL)
+
+	if query.Get("session") != "" {
+		constraint, err := parseSessionConstraint(query.Get("session"))
+		if err != nil {
+			return err
+		}
+		conn.session = NewSession(constraint)
+	}
+
+	var rate float64
+	if query.Get("rate_limit") != "" {
+		rate, err = strconv.ParseFloat(query.Get("rate_limit"), 64)
+		if err != nil {
+			return errors.New("invalid rate_limit specified: " + err.Error())
+		}
+	}
+	var burst, maxInflight int
+	if query.Get("rate_burst") != "" {
+		burst, err = strconv.Atoi(query.Get("rate_burst"))
+		if err != nil {
+			return errors.New("invalid rate_burst specified: " + err.Error())
+		}
+	}
+	if query.Get("max_inflight") != "" {
+		maxInflight, err = strconv.Atoi(query.Get("max_inflight"))
+		if err != nil {
+			return errors.New("invalid max_inflight specified: " + err.Error())
+		}
+	}
+	if rate > 0 || maxInflight > 0 {
+		conn.limiter, err = limiterFor(conn.accountId, rate, burst, maxInflight)
+		if err != nil {
+			return err
+		}
+	}
+
+	if query.Get("breaker_ratio") != "" {
+		ratio, err := strconv.ParseFloat(query.Get("breaker_ratio"), 64)
+		if err != nil || ratio <= 0 || ratio > 1 {
+			return errors.New("invalid breaker_ratio specified, must be within (0, 1]")
+		}
+		var settings = map[string]int{
+			"breaker_min_requests": defaultBreakerMinRequests,
+			"breaker_window":       defaultBreakerWindowSecond,
+			"breaker_cooldown":     defaultBreakerCooldownSecond,
+			"breaker_probes":       defaultBreakerProbes,
+		}
+		for name := range settings {
+			if query.Get(name) == "" {
+				continue
+			}
+			value, err := strconv.Atoi(query.Get(name))
+			if err != nil || value <= 0 {
+				return errors.New("invalid " + name + " specified, must be a positive integer")
+			}
+			settings[name] = value
+		}
+		conn.breaker, err = breakerFor(conn.accountId, ratio,
+			settings["breaker_min_requests"],
+			time.Second*time.Duration(settings["breaker_window"]),
+			time.Second*time.Duration(settings["breaker_cooldown"]),
+			settings["breaker_probes"],
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	conn.limits = Limits{MaxParams: defaultMaxParams, MaxSQLLength: defaultMaxSQLLength}
+	if query.Get("max_params") != "" {
+		conn.limits.MaxParams, err = strconv.Atoi(query.Get("max_params"))
+		if err != nil {
+			return errors.New("invalid max_params specified: " + err.Error())
+		}
+	}
+	if query.Get("max_sql_length") != "" {
+		conn.limits.MaxSQLLength, err = strconv.Atoi(query.Get("max_sql_length"))
+		if err != nil {
+			return errors.New("invalid max_sql_length specified: " + err.Error())
+		}
+	}
+	if query.Get("split_inserts") != "" {
+		conn.splitInserts, err = strconv.ParseBool(query.Get("split_inserts"))
+		if err != nil {
+			return errors.New("invalid split_inserts specified: " + err.Error())
+		}
+	}
+
+	conn.txMode, err = parseTransactionMode(query.Get("tx"))
+	if err != nil {
+		return err
+	}
+
+	conn.timeFormat = time.RFC3339Nano
+	if query.Get("time_format") != "" {
+		conn.timeFormat = query.Get("time_format")
+	}
+
 	// Initialize http client for connection
 	conn.client = http.Client{
 		Transport: http.DefaultTransport,
@@ -101,6 +229,9 @@ func (conn *Connection) init(dsn string) error {
 	Trace("%s:    %s -> %s", conn.ID, "apiToken", conn.apiToken)
 	Trace("%s:    %s -> %s", conn.ID, "databaseId", conn.databaseId)
 
-	// verify connection
-	return conn.VerifyApiTokenContext(context.Background())
+	// verify connection, lazy mode defers it to the first statement
+	if conn.verifyMode != VerifyEager {
+		return nil
+	}
+	return conn.ensureVerified(context.Background())
 }
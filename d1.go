@@ -20,12 +20,19 @@ var (
 	ErrShortDSN   = errors.New("dsn specified is impossibly short")
 	ErrNotD1      = errors.New("dsn does not start with 'd1'")
 	ErrInvalidDB  = errors.New("invalid database id")
+
+	// ErrCircuitOpen is returned without calling the api while the circuit
+	// breaker of the account is open.
+	ErrCircuitOpen = errors.New("d1: circuit breaker is open")
 )
 
 // Open opens a new connection to the database.
 // The dsn looks like:
 //
-//	d1://apiToken:accountId@databaseId?timeout=10
+//	d1://apiToken:accountId@databaseId?timeout=10&verify=lazy&verify_ttl=300
+//
+// The verify option is one of eager (default), lazy or off, successful
+// verifications are cached process wide for verify_ttl seconds.
 func Open(dsn string) (conn *Connection, err error) {
 	conn = &Connection{}
 
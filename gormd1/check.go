@@ -0,0 +1,230 @@
+package gormd1
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var ErrSchemaDrift = errors.New("schema drift")
+
+// DiffKind tells what differs between a model and the database.
+type DiffKind string
+
+const (
+	DiffMissingTable  DiffKind = "missing table"
+	DiffMissingColumn DiffKind = "missing column"
+	DiffColumnType    DiffKind = "column type"
+	DiffNullable      DiffKind = "nullable"
+	DiffDefault       DiffKind = "default"
+	DiffMissingIndex  DiffKind = "missing index"
+	DiffIndex         DiffKind = "index"
+)
+
+// SchemaDiff is a difference between a model and the database.
+type SchemaDiff struct {
+	Kind  DiffKind
+	Table string
+	// Column or Index names what differs within the table.
+	Column string
+	Index  string
+	// Expected is what the model declares, Actual what the database has.
+	Expected string
+	Actual   string
+}
+
+func (d SchemaDiff) String() string {
+	var b strings.Builder
+	b.WriteString(string(d.Kind))
+	b.WriteString(" ")
+	b.WriteString(d.Table)
+	if d.Column != "" {
+		b.WriteString(".")
+		b.WriteString(d.Column)
+	}
+	if d.Index != "" {
+		b.WriteString(" ")
+		b.WriteString(d.Index)
+	}
+	if d.Expected != "" || d.Actual != "" {
+		fmt.Fprintf(&b, ": expected %q, actual %q", d.Expected, d.Actual)
+	}
+	return b.String()
+}
+
+// SchemaReport lists the differences between the models and the database.
+type SchemaReport struct {
+	Diffs []SchemaDiff
+}
+
+// OK tells whether the database matches the models.
+func (r *SchemaReport) OK() bool {
+	return len(r.Diffs) == 0
+}
+
+// Err returns an error matching ErrSchemaDrift listing the differences, or
+// nil when the database matches the models.
+func (r *SchemaReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrSchemaDrift, r)
+}
+
+func (r *SchemaReport) String() string {
+	diffs := make([]string, 0, len(r.Diffs))
+	for _, diff := range r.Diffs {
+		diffs = append(diffs, diff.String())
+	}
+	return strings.Join(diffs, "; ")
+}
+
+// CheckSchema compares the tables, columns, types, nullability, defaults
+// and indexes of the models to the database without changing anything.
+// Columns and indexes of the database which the models lack are left out,
+// other services may rely on them.
+func CheckSchema(db *gorm.DB, models ...interface{}) (*SchemaReport, error) {
+	m, ok := db.Migrator().(Migrator)
+	if !ok {
+		return nil, errors.New("invalid dialector specified: " + db.Dialector.Name())
+	}
+
+	report := &SchemaReport{}
+	for _, model := range models {
+		if err := m.RunWithValue(model, func(stmt *gorm.Statement) error {
+			diffs, err := m.checkTable(model, stmt)
+			report.Diffs = append(report.Diffs, diffs...)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func (m Migrator) checkTable(model interface{}, stmt *gorm.Statement) ([]SchemaDiff, error) {
+	if stmt.Schema == nil {
+		return nil, fmt.Errorf("failed to get schema of %v", stmt.Table)
+	}
+	if !m.HasTable(stmt.Table) {
+		return []SchemaDiff{{Kind: DiffMissingTable, Table: stmt.Table}}, nil
+	}
+
+	columnTypes, err := m.ColumnTypes(model)
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]gorm.ColumnType, len(columnTypes))
+	for _, columnType := range columnTypes {
+		columns[columnType.Name()] = columnType
+	}
+
+	var diffs []SchemaDiff
+	for _, dbName := range stmt.Schema.DBNames {
+		field := stmt.Schema.FieldsByDBName[dbName]
+		if field.IgnoreMigration {
+			continue
+		}
+		columnType, ok := columns[dbName]
+		if !ok {
+			diffs = append(diffs, SchemaDiff{Kind: DiffMissingColumn, Table: stmt.Table, Column: dbName})
+			continue
+		}
+		columnDiffs, err := m.checkColumn(field, columnType)
+		if err != nil {
+			return nil, err
+		}
+		for _, diff := range columnDiffs {
+			diff.Table, diff.Column = stmt.Table, dbName
+			diffs = append(diffs, diff)
+		}
+	}
+
+	indexes, err := m.GetIndexes(model)
+	if err != nil {
+		return nil, err
+	}
+	actualIndexes := make(map[string]gorm.Index, len(indexes))
+	for _, index := range indexes {
+		actualIndexes[index.Name()] = index
+	}
+	for _, idx := range stmt.Schema.ParseIndexes() {
+		expected := describeIndex(idx.Class == "UNIQUE", indexFields(idx))
+		index, ok := actualIndexes[idx.Name]
+		if !ok {
+			diffs = append(diffs, SchemaDiff{Kind: DiffMissingIndex, Table: stmt.Table, Index: idx.Name, Expected: expected})
+			continue
+		}
+		unique, _ := index.Unique()
+		if actual := describeIndex(unique, index.Columns()); actual != expected {
+			diffs = append(diffs, SchemaDiff{Kind: DiffIndex, Table: stmt.Table, Index: idx.Name, Expected: expected, Actual: actual})
+		}
+	}
+	return diffs, nil
+}
+
+func (m Migrator) checkColumn(field *schema.Field, columnType gorm.ColumnType) ([]SchemaDiff, error) {
+	var diffs []SchemaDiff
+
+	// the type is declared first, leave out the constraints DataTypeOf adds
+	declared, err := parseDDL(fmt.Sprintf("CREATE TABLE t (c %s)", m.DataTypeOf(field)))
+	if err != nil {
+		return nil, err
+	}
+	expectedType := declared.columns[0].dataType
+	if actualType := columnType.DatabaseTypeName(); !strings.EqualFold(expectedType, actualType) {
+		diffs = append(diffs, SchemaDiff{Kind: DiffColumnType, Expected: expectedType, Actual: actualType})
+	}
+
+	expectedNullable := !field.NotNull && !field.PrimaryKey
+	if nullable, ok := columnType.Nullable(); ok && nullable != expectedNullable {
+		diffs = append(diffs, SchemaDiff{Kind: DiffNullable, Expected: fmt.Sprint(expectedNullable), Actual: fmt.Sprint(nullable)})
+	}
+
+	expectedDefault, hasDefault := fieldDefault(field)
+	actualDefault, ok := columnType.DefaultValue()
+	if ok && strings.EqualFold(actualDefault, "NULL") {
+		ok = false
+	}
+	if hasDefault != ok || expectedDefault != actualDefault {
+		diffs = append(diffs, SchemaDiff{Kind: DiffDefault, Expected: expectedDefault, Actual: actualDefault})
+	}
+	return diffs, nil
+}
+
+// fieldDefault returns the default of the field as PRAGMA table_info
+// reports it, unquoted.
+func fieldDefault(field *schema.Field) (string, bool) {
+	if !field.HasDefaultValue || field.AutoIncrement {
+		return "", false
+	}
+	if field.DefaultValueInterface != nil {
+		return fmt.Sprint(field.DefaultValueInterface), true
+	}
+	if field.DefaultValue == "" || strings.EqualFold(field.DefaultValue, "NULL") {
+		return "", false
+	}
+	return unquoteDefault(field.DefaultValue), true
+}
+
+func indexFields(idx schema.Index) []string {
+	columns := make([]string, 0, len(idx.Fields))
+	for _, field := range idx.Fields {
+		// expressions aren't reported by PRAGMA index_info
+		if field.Expression == "" {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns
+}
+
+func describeIndex(unique bool, columns []string) string {
+	description := "(" + strings.Join(columns, ", ") + ")"
+	if unique {
+		return "UNIQUE " + description
+	}
+	return description
+}
@@ -0,0 +1,60 @@
+package gormd1
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/schema"
+)
+
+type checkedModel struct {
+	ID      uint
+	Status  string `gorm:"default:'open'"`
+	Active  bool   `gorm:"default:true"`
+	Created string `gorm:"default:CURRENT_TIMESTAMP"`
+	Note    string `gorm:"default:null"`
+	Name    string
+}
+
+func TestFieldDefault(t *testing.T) {
+	parsed, err := schema.Parse(&checkedModel{}, &sync.Map{}, schema.NamingStrategy{})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var tests = map[string]struct {
+		value string
+		ok    bool
+	}{
+		"id":      {"", false},
+		"status":  {"open", true},
+		"active":  {"true", true},
+		"created": {"CURRENT_TIMESTAMP", true},
+		"note":    {"", false},
+		"name":    {"", false},
+	}
+	for column, expected := range tests {
+		value, ok := fieldDefault(parsed.FieldsByDBName[column])
+		assert.Equalf(t, expected.value, value, column)
+		assert.Equalf(t, expected.ok, ok, column)
+	}
+}
+
+func TestSchemaReport(t *testing.T) {
+	report := &SchemaReport{}
+	assert.True(t, report.OK())
+	assert.Nil(t, report.Err())
+
+	report.Diffs = []SchemaDiff{
+		{Kind: DiffMissingTable, Table: "gadgets"},
+		{Kind: DiffColumnType, Table: "users", Column: "age", Expected: "integer", Actual: "text"},
+		{Kind: DiffIndex, Table: "users", Index: "idx_users_name", Expected: describeIndex(true, []string{"name"}), Actual: describeIndex(false, []string{"name", "age"})},
+	}
+	assert.False(t, report.OK())
+	assert.True(t, errors.Is(report.Err(), ErrSchemaDrift))
+	assert.Equal(t, `schema drift: missing table gadgets; `+
+		`column type users.age: expected "integer", actual "text"; `+
+		`index users idx_users_name: expected "UNIQUE (name)", actual "(name, age)"`, report.Err().Error())
+}
@@ -0,0 +1,104 @@
+package gormd1_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Member struct {
+	ID     uint   `gorm:"primaryKey"`
+	Team   string `gorm:"uniqueIndex:idx_members_team_name"`
+	Name   string `gorm:"uniqueIndex:idx_members_team_name"`
+	Score  int
+	Badges int
+}
+
+func TestClauseBuildersDryRun(t *testing.T) {
+	dry := gdb.Session(&gorm.Session{DryRun: true})
+
+	rows := []struct {
+		description string
+		tx          *gorm.DB
+		sql         string
+	}{
+		{
+			description: "do update",
+			tx: dry.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "team"}, {Name: "name"}},
+				DoUpdates: clause.AssignmentColumns([]string{"score"}),
+			}).Create(&Member{Team: "a", Name: "kofj", Score: 1}),
+			sql: "INSERT INTO `members` (`team`,`name`,`score`,`badges`) VALUES (?,?,?,?) ON CONFLICT (`team`,`name`) DO UPDATE SET `score`=`excluded`.`score` RETURNING `id`",
+		},
+		{
+			description: "do nothing",
+			tx:          dry.Clauses(clause.OnConflict{DoNothing: true}).Create(&Member{Team: "a", Name: "kofj"}),
+			sql:         "INSERT INTO `members` (`team`,`name`,`score`,`badges`) VALUES (?,?,?,?) ON CONFLICT DO NOTHING RETURNING `id`",
+		},
+		{
+			description: "on constraint",
+			tx: dry.Clauses(clause.OnConflict{
+				OnConstraint: "idx_members_team_name",
+				DoUpdates:    clause.Assignments(map[string]interface{}{"badges": gorm.Expr("`badges` + 1")}),
+			}).Create(&Member{Team: "a", Name: "kofj"}),
+			sql: "INSERT INTO `members` (`team`,`name`,`score`,`badges`) VALUES (?,?,?,?) ON CONFLICT (`team`,`name`) DO UPDATE SET `badges`=`badges` + 1 RETURNING `id`",
+		},
+		{
+			description: "or ignore",
+			tx:          dry.Clauses(clause.Insert{Modifier: "OR IGNORE"}).Create(&Member{Team: "a", Name: "kofj"}),
+			sql:         "INSERT OR IGNORE INTO `members` (`team`,`name`,`score`,`badges`) VALUES (?,?,?,?) RETURNING `id`",
+		},
+		{
+			description: "mysql ignore",
+			tx:          dry.Clauses(clause.Insert{Modifier: "IGNORE"}).Create(&Member{Team: "a", Name: "kofj"}),
+			sql:         "INSERT OR IGNORE INTO `members` (`team`,`name`,`score`,`badges`) VALUES (?,?,?,?) RETURNING `id`",
+		},
+		{
+			description: "or replace",
+			tx:          dry.Clauses(clause.Insert{Modifier: "OR REPLACE"}).Create(&Member{Team: "a", Name: "kofj"}),
+			sql:         "INSERT OR REPLACE INTO `members` (`team`,`name`,`score`,`badges`) VALUES (?,?,?,?) RETURNING `id`",
+		},
+	}
+
+	for _, row := range rows {
+		t.Run(row.description, func(t *testing.T) {
+			if !assert.Nil(t, row.tx.Error) {
+				return
+			}
+			assert.Equal(t, row.sql, strings.TrimSpace(row.tx.Statement.SQL.String()))
+		})
+	}
+
+	tx := dry.Clauses(clause.OnConflict{OnConstraint: "no_such_index", DoNothing: true}).Create(&Member{})
+	assert.NotNil(t, tx.Error, "unknown constraint")
+}
+
+func TestUpsert(t *testing.T) {
+	if err := gdb.AutoMigrate(&Member{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&Member{})
+	})
+
+	members := []Member{{Team: "a", Name: "kofj", Score: 1}, {Team: "b", Name: "kofj", Score: 2}}
+	if err := gdb.Create(&members).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+
+	var err = gdb.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "team"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"score"}),
+	}).Create(&[]Member{{Team: "a", Name: "kofj", Score: 10}, {Team: "c", Name: "kofj", Score: 3}}).Error
+	assert.Nilf(t, err, "upsert")
+
+	err = gdb.Clauses(clause.Insert{Modifier: "OR IGNORE"}).Create(&Member{Team: "b", Name: "kofj", Score: 20}).Error
+	assert.Nilf(t, err, "insert or ignore")
+
+	var scores []int
+	gdb.Model(&Member{}).Order("team").Pluck("score", &scores)
+	assert.Equal(t, []int{10, 2, 3}, scores)
+}
@@ -0,0 +1,100 @@
+package gormd1
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	d1 "github.com/kofj/gorm-driver-d1"
+	"github.com/kofj/gorm-driver-d1/stdlib"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestDSNWithOptions(t *testing.T) {
+	const dsn = "d1://account:token@00000000-0000-0000-0000-000000000000"
+
+	dialector := New(Config{DSN: dsn}).(*Dialector)
+	assert.Equal(t, dsn, dialector.dsnWithOptions())
+
+	dialector = New(Config{
+		DSN:                   dsn + "?tx=none&timeout=10",
+		DefaultTimeFormat:     "2006-01-02 15:04:05",
+		MaxParamsPerStatement: 50,
+		TransactionMode:       d1.TransactionBatch,
+	}).(*Dialector)
+	assert.Equal(t,
+		dsn+"?max_params=50&time_format=2006-01-02+15%3A04%3A05&timeout=10&tx=batch",
+		dialector.dsnWithOptions(),
+	)
+}
+
+func TestDialectorWithoutConfig(t *testing.T) {
+	const dsn = "d1://account:token@00000000-0000-0000-0000-000000000000?verify=off"
+	conn := sql.OpenDB(stdlib.NewConnector(dsn))
+
+	dialector := &Dialector{Conn: conn, BoolCheck: true}
+	db, err := gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, conn, db.ConnPool)
+	assert.Equal(t, conn, dialector.Config.Conn)
+	assert.True(t, dialector.Config.BoolCheck)
+}
+
+func TestExplain(t *testing.T) {
+	dialector := Dialector{Config: &Config{}, ctx: context.Background(), log: logger.Discard}
+
+	var tests = []struct {
+		v        interface{}
+		expected string
+	}{
+		{"open", "DEFAULT 'open'"},
+		{"it's", "DEFAULT 'it''s'"},
+		{`say "hi"`, `DEFAULT 'say "hi"'`},
+		{time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.UTC), "DEFAULT '2024-01-02 03:04:05.5'"},
+		{[]byte("abc"), "DEFAULT 'abc'"},
+		{nil, "DEFAULT NULL"},
+		{42, "DEFAULT 42"},
+		{1.5, "DEFAULT 1.5"},
+		{true, "DEFAULT true"},
+	}
+	for _, test := range tests {
+		assert.Equalf(t, test.expected, dialector.Explain("DEFAULT ?", test.v), "%v", test.v)
+	}
+}
+
+type returningModel struct {
+	ID   uint
+	Name string
+}
+
+func TestReturningTransactionMode(t *testing.T) {
+	const dsn = "d1://account:token@00000000-0000-0000-0000-000000000000?verify=off"
+
+	var tests = []struct {
+		description string
+		config      Config
+		returning   bool
+	}{
+		{"default", Config{DSN: dsn}, true},
+		{"config", Config{DSN: dsn, TransactionMode: d1.TransactionBatch}, false},
+		{"dsn", Config{DSN: dsn + "&tx=batch"}, false},
+		{"config over dsn", Config{DSN: dsn + "&tx=none", TransactionMode: d1.TransactionBatch}, false},
+		{"conn", Config{Conn: sql.OpenDB(stdlib.NewConnector(dsn + "&tx=batch"))}, false},
+		{"conn over config", Config{Conn: sql.OpenDB(stdlib.NewConnector(dsn)), TransactionMode: d1.TransactionBatch}, true},
+		{"disabled", Config{DSN: dsn, DisableReturning: true}, false},
+	}
+	for _, test := range tests {
+		db, err := gorm.Open(New(test.config), &gorm.Config{DisableAutomaticPing: true, DryRun: true, Logger: logger.Discard})
+		if !assert.Nilf(t, err, test.description) {
+			continue
+		}
+		query := db.Create(&returningModel{Name: "kofj"}).Statement.SQL.String()
+		assert.Equalf(t, test.returning, strings.Contains(query, "RETURNING"), "%s: %s", test.description, query)
+	}
+}
@@ -1,289 +1,871 @@
 package gormd1
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
+)
 
-	"gorm.io/gorm/migrator"
+// A small tokenizer and parser of SQLite's CREATE TABLE statements, see
+// https://www.sqlite.org/lang_createtable.html
+//
+// Definitions are kept as written, minus comments, so a table can be
+// recreated with a column or constraint changed and everything else
+// untouched.
+
+type tokenKind int
+
+const (
+	tokenWord   tokenKind = iota + 1 // keywords and bare identifiers
+	tokenQuoted                      // "name", `name` and [name]
+	tokenString                      // 'text' and x'blob'
+	tokenNumber
+	tokenPunct // parentheses, commas and operators
 )
 
-var (
-	sqliteSeparator    = "`|\"|'|\t"
-	uniqueRegexp       = regexp.MustCompile(fmt.Sprintf(`^CONSTRAINT [%v]?[\w-]+[%v]? UNIQUE (.*)$`, sqliteSeparator, sqliteSeparator))
-	indexRegexp        = regexp.MustCompile(fmt.Sprintf(`(?is)CREATE(?: UNIQUE)? INDEX [%v]?[\w\d-]+[%v]?(?s:.*?)ON (.*)$`, sqliteSeparator, sqliteSeparator))
-	tableRegexp        = regexp.MustCompile(fmt.Sprintf(`(?is)(CREATE TABLE [%v]?[\w\d-]+[%v]?)(?:\s*\((.*)\))?`, sqliteSeparator, sqliteSeparator))
-	separatorRegexp    = regexp.MustCompile(fmt.Sprintf("[%v]", sqliteSeparator))
-	columnsRegexp      = regexp.MustCompile(fmt.Sprintf(`[(,][%v]?(\w+)[%v]?`, sqliteSeparator, sqliteSeparator))
-	columnRegexp       = regexp.MustCompile(fmt.Sprintf(`^[%v]?([\w\d]+)[%v]?\s+([\w\(\)\d]+)(.*)$`, sqliteSeparator, sqliteSeparator))
-	defaultValueRegexp = regexp.MustCompile(`(?i) DEFAULT \(?(.+)?\)?( |COLLATE|GENERATED|$)`)
-	regRealDataType    = regexp.MustCompile(`[^\d](\d+)[^\d]?`)
+type token struct {
+	kind tokenKind
+	text string
+	// space tells whether whitespace or a comment precedes the token.
+	space bool
+}
+
+func (t token) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (t token) isPunct(punct string) bool {
+	return t.kind == tokenPunct && t.text == punct
+}
+
+func (t token) isName() bool {
+	return t.kind == tokenWord || t.kind == tokenQuoted || t.kind == tokenString
+}
+
+// name returns the identifier the token stands for, unquoted.
+func (t token) name() string {
+	switch t.kind {
+	case tokenQuoted, tokenString:
+		if t.text[0] == '[' {
+			return t.text[1 : len(t.text)-1]
+		}
+		quote := t.text[:1]
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], quote+quote, quote)
+	}
+	return t.text
+}
+
+func tokenize(sql string) ([]token, error) {
+	var (
+		tokens []token
+		space  bool
+	)
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			space = true
+			continue
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+			space = true
+			continue
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("invalid DDL, unterminated comment")
+			}
+			i += end + 4
+			space = true
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			end, err := quotedEnd(sql, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case c == '[':
+			end := strings.IndexByte(sql[i:], ']')
+			if end < 0 {
+				return nil, errors.New("invalid DDL, unterminated identifier")
+			}
+			i += end + 1
+		case (c == 'x' || c == 'X') && i+1 < len(sql) && sql[i+1] == '\'':
+			end, err := quotedEnd(sql, i+1)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case isIdentStart(c):
+			for i < len(sql) && isIdentPart(sql[i]) {
+				i++
+			}
+		case isDigit(c) || (c == '.' && i+1 < len(sql) && isDigit(sql[i+1])):
+			i = numberEnd(sql, i)
+		default:
+			i++
+			// two character operators
+			if i < len(sql) {
+				switch sql[start : i+1] {
+				case "||", "<=", ">=", "==", "!=", "<>", "<<", ">>", "->":
+					i++
+					if sql[start:i] == "->" && i < len(sql) && sql[i] == '>' {
+						i++
+					}
+				}
+			}
+		}
+
+		tokens = append(tokens, token{kind: kindOf(sql[start:i]), text: sql[start:i], space: space})
+		space = false
+	}
+	return tokens, nil
+}
+
+func kindOf(text string) tokenKind {
+	switch c := text[0]; {
+	case c == '"' || c == '`' || c == '[':
+		return tokenQuoted
+	case c == '\'' || ((c == 'x' || c == 'X') && len(text) > 1 && text[1] == '\''):
+		return tokenString
+	case isIdentStart(c):
+		return tokenWord
+	case isDigit(c) || (c == '.' && len(text) > 1):
+		return tokenNumber
+	}
+	return tokenPunct
+}
+
+// quotedEnd returns the end of the quoted text starting at i, doubled
+// quotes escape the quote.
+func quotedEnd(sql string, i int) (int, error) {
+	quote := sql[i]
+	for j := i + 1; j < len(sql); j++ {
+		if sql[j] != quote {
+			continue
+		}
+		if j+1 < len(sql) && sql[j+1] == quote {
+			j++
+			continue
+		}
+		return j + 1, nil
+	}
+	return 0, fmt.Errorf("invalid DDL, unterminated %c", quote)
+}
+
+func numberEnd(sql string, i int) int {
+	if strings.HasPrefix(sql[i:], "0x") || strings.HasPrefix(sql[i:], "0X") {
+		i += 2
+		for i < len(sql) && isIdentPart(sql[i]) {
+			i++
+		}
+		return i
+	}
+	for i < len(sql) && (isDigit(sql[i]) || sql[i] == '.' || sql[i] == '_') {
+		i++
+	}
+	if i < len(sql) && (sql[i] == 'e' || sql[i] == 'E') {
+		i++
+		if i < len(sql) && (sql[i] == '+' || sql[i] == '-') {
+			i++
+		}
+		for i < len(sql) && isDigit(sql[i]) {
+			i++
+		}
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+// joinTokens renders tokens as written, with a single space wherever the
+// source had whitespace or comments.
+func joinTokens(tokens []token) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && t.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// Kinds of constraints.
+const (
+	constraintPrimaryKey = "PRIMARY KEY"
+	constraintNotNull    = "NOT NULL"
+	constraintNull       = "NULL"
+	constraintUnique     = "UNIQUE"
+	constraintCheck      = "CHECK"
+	constraintDefault    = "DEFAULT"
+	constraintCollate    = "COLLATE"
+	constraintForeignKey = "FOREIGN KEY"
+	constraintGenerated  = "GENERATED"
 )
 
-func getAllColumns(s string) []string {
-	allMatches := columnsRegexp.FindAllStringSubmatch(s, -1)
-	columns := make([]string, 0, len(allMatches))
-	for _, matches := range allMatches {
-		if len(matches) > 1 {
-			columns = append(columns, matches[1])
+type ddlConstraint struct {
+	// name is set by `CONSTRAINT name`.
+	name string
+	// kind is one of the constraint* constants, it's empty for
+	// constraints added as raw sql.
+	kind string
+	// columns of table constraints.
+	columns []string
+	// expr is the expression of CHECK, DEFAULT and GENERATED, the
+	// collation name of COLLATE and the referenced table of foreign keys.
+	expr          string
+	autoIncrement bool
+	// stored is set for STORED generated columns.
+	stored bool
+	// onDelete is the ON DELETE action of foreign keys, like "CASCADE",
+	// it's empty for NO ACTION.
+	onDelete string
+	sql      string
+}
+
+type ddlColumn struct {
+	name        string
+	dataType    string
+	constraints []ddlConstraint
+	// sql is the definition of the column, name included.
+	sql string
+}
+
+func (c *ddlColumn) constraint(kind string) *ddlConstraint {
+	for i := range c.constraints {
+		if c.constraints[i].kind == kind {
+			return &c.constraints[i]
 		}
 	}
-	return columns
+	return nil
+}
+
+func (c *ddlColumn) generated() bool {
+	return c.constraint(constraintGenerated) != nil
 }
 
 type ddl struct {
-	head    string
-	fields  []string
-	columns []migrator.ColumnType
+	temporary   bool
+	ifNotExists bool
+	schema      string
+	table       string
+	columns     []ddlColumn
+	constraints []ddlConstraint
+	// options are STRICT and WITHOUT ROWID.
+	options []string
+	// copies maps columns to the expressions rebuilds copy their rows
+	// with, they aren't part of the DDL.
+	copies map[string]string
+}
+
+func parseDDL(sql string) (*ddl, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &ddlParser{tokens: tokens}
+	result, err := p.parseCreateTable()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DDL, %w", err)
+	}
+	return result, nil
+}
+
+type ddlParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *ddlParser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{}
+}
+
+func (p *ddlParser) next() token {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *ddlParser) eof() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// accept consumes the keywords if they're next.
+func (p *ddlParser) accept(keywords ...string) bool {
+	for i, keyword := range keywords {
+		if p.pos+i >= len(p.tokens) || !p.tokens[p.pos+i].is(keyword) {
+			return false
+		}
+	}
+	p.pos += len(keywords)
+	return true
+}
+
+func (p *ddlParser) expect(keywords ...string) error {
+	if !p.accept(keywords...) {
+		return fmt.Errorf("expected %s near %q", strings.Join(keywords, " "), p.peek().text)
+	}
+	return nil
+}
+
+func (p *ddlParser) acceptPunct(punct string) bool {
+	if p.peek().isPunct(punct) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ddlParser) expectName() (string, error) {
+	if t := p.peek(); !t.isName() {
+		return "", fmt.Errorf("expected name near %q", t.text)
+	}
+	return p.next().name(), nil
 }
 
-func parseDDL(strs ...string) (*ddl, error) {
+// group consumes a parenthesized group, returning the tokens between
+// the parentheses.
+func (p *ddlParser) group() ([]token, error) {
+	if !p.acceptPunct("(") {
+		return nil, fmt.Errorf("expected ( near %q", p.peek().text)
+	}
+	start := p.pos
+	for depth := 1; depth > 0; {
+		if p.eof() {
+			return nil, errors.New("unbalanced brackets")
+		}
+		switch t := p.next(); {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		}
+	}
+	return p.tokens[start : p.pos-1], nil
+}
+
+func (p *ddlParser) parseCreateTable() (*ddl, error) {
 	var result ddl
-	for _, str := range strs {
-		if sections := tableRegexp.FindStringSubmatch(str); len(sections) > 0 {
-			var (
-				ddlBody      = sections[2]
-				ddlBodyRunes = []rune(ddlBody)
-				bracketLevel int
-				quote        rune
-				buf          string
-			)
-			ddlBodyRunesLen := len(ddlBodyRunes)
-
-			result.head = sections[1]
-
-			for idx := 0; idx < ddlBodyRunesLen; idx++ {
-				var (
-					next rune = 0
-					c         = ddlBodyRunes[idx]
-				)
-				if idx+1 < ddlBodyRunesLen {
-					next = ddlBodyRunes[idx+1]
-				}
+	if err := p.expect("CREATE"); err != nil {
+		return nil, err
+	}
+	result.temporary = p.accept("TEMP") || p.accept("TEMPORARY")
+	if err := p.expect("TABLE"); err != nil {
+		return nil, err
+	}
+	result.ifNotExists = p.accept("IF", "NOT", "EXISTS")
 
-				if sc := string(c); separatorRegexp.MatchString(sc) {
-					if c == next {
-						buf += sc // Skip escaped quote
-						idx++
-					} else if quote > 0 {
-						quote = 0
-					} else {
-						quote = c
-					}
-				} else if quote == 0 {
-					if c == '(' {
-						bracketLevel++
-					} else if c == ')' {
-						bracketLevel--
-					} else if bracketLevel == 0 {
-						if c == ',' {
-							result.fields = append(result.fields, strings.TrimSpace(buf))
-							buf = ""
-							continue
-						}
-					}
-				}
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptPunct(".") {
+		result.schema = name
+		if name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	result.table = name
 
-				if bracketLevel < 0 {
-					return nil, errors.New("invalid DDL, unbalanced brackets")
-				}
+	if p.accept("AS") {
+		return nil, errors.New("CREATE TABLE ... AS SELECT is not supported")
+	}
+	if !p.acceptPunct("(") {
+		return nil, fmt.Errorf("expected ( near %q", p.peek().text)
+	}
 
-				buf += string(c)
+	for {
+		if p.peekTableConstraint() {
+			constraint, err := p.parseTableConstraint()
+			if err != nil {
+				return nil, err
 			}
-
-			if bracketLevel != 0 {
-				return nil, errors.New("invalid DDL, unbalanced brackets")
+			result.constraints = append(result.constraints, constraint)
+		} else if len(result.constraints) > 0 {
+			return nil, fmt.Errorf("column definition after table constraints near %q", p.peek().text)
+		} else {
+			column, err := p.parseColumn()
+			if err != nil {
+				return nil, err
 			}
+			result.columns = append(result.columns, column)
+		}
+
+		if p.acceptPunct(",") {
+			continue
+		}
+		if p.acceptPunct(")") {
+			break
+		}
+		if p.eof() {
+			return nil, errors.New("unbalanced brackets")
+		}
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
 
-			if buf != "" {
-				result.fields = append(result.fields, strings.TrimSpace(buf))
+	for !p.eof() {
+		switch {
+		case p.accept("STRICT"):
+			result.options = append(result.options, "STRICT")
+		case p.accept("WITHOUT", "ROWID"):
+			result.options = append(result.options, "WITHOUT ROWID")
+		case p.acceptPunct(";"):
+			if !p.eof() {
+				return nil, fmt.Errorf("unexpected %q after statement", p.peek().text)
 			}
+			continue
+		default:
+			return nil, fmt.Errorf("unexpected %q", p.peek().text)
+		}
+		if !p.acceptPunct(",") && !p.eof() && !p.peek().isPunct(";") {
+			return nil, fmt.Errorf("unexpected %q", p.peek().text)
+		}
+	}
 
-			for _, f := range result.fields {
-				fUpper := strings.ToUpper(f)
-				if strings.HasPrefix(fUpper, "CHECK") {
-					continue
-				}
-				if strings.HasPrefix(fUpper, "CONSTRAINT") {
-					matches := uniqueRegexp.FindStringSubmatch(f)
-					if len(matches) > 0 {
-						if columns := getAllColumns(matches[1]); len(columns) == 1 {
-							for idx, column := range result.columns {
-								if column.NameValue.String == columns[0] {
-									column.UniqueValue = sql.NullBool{Bool: true, Valid: true}
-									result.columns[idx] = column
-									break
-								}
-							}
-						}
-					}
-					continue
-				}
-				if strings.HasPrefix(fUpper, "PRIMARY KEY") {
-					for _, name := range getAllColumns(f) {
-						for idx, column := range result.columns {
-							if column.NameValue.String == name {
-								column.PrimaryKeyValue = sql.NullBool{Bool: true, Valid: true}
-								result.columns[idx] = column
-								break
-							}
-						}
-					}
-				} else if matches := columnRegexp.FindStringSubmatch(f); len(matches) > 0 {
-					columnType := migrator.ColumnType{
-						NameValue:         sql.NullString{String: matches[1], Valid: true},
-						DataTypeValue:     sql.NullString{String: matches[2], Valid: true},
-						ColumnTypeValue:   sql.NullString{String: matches[2], Valid: true},
-						PrimaryKeyValue:   sql.NullBool{Valid: true},
-						UniqueValue:       sql.NullBool{Valid: true},
-						NullableValue:     sql.NullBool{Bool: true, Valid: true},
-						DefaultValueValue: sql.NullString{Valid: false},
-					}
+	if len(result.columns) == 0 {
+		return nil, errors.New("no columns")
+	}
+	return &result, nil
+}
 
-					matchUpper := strings.ToUpper(matches[3])
-					if strings.Contains(matchUpper, " NOT NULL") {
-						columnType.NullableValue = sql.NullBool{Bool: false, Valid: true}
-					} else if strings.Contains(matchUpper, " NULL") {
-						columnType.NullableValue = sql.NullBool{Bool: true, Valid: true}
-					}
-					if strings.Contains(matchUpper, " UNIQUE") {
-						columnType.UniqueValue = sql.NullBool{Bool: true, Valid: true}
-					}
-					if strings.Contains(matchUpper, " PRIMARY") {
-						columnType.PrimaryKeyValue = sql.NullBool{Bool: true, Valid: true}
-					}
-					if defaultMatches := defaultValueRegexp.FindStringSubmatch(matches[3]); len(defaultMatches) > 1 {
-						if strings.ToLower(defaultMatches[1]) != "null" {
-							columnType.DefaultValueValue = sql.NullString{String: strings.Trim(defaultMatches[1], `"`), Valid: true}
-						}
-					}
+func (p *ddlParser) peekTableConstraint() bool {
+	t := p.peek()
+	return t.is("CONSTRAINT") || t.is("PRIMARY") || t.is("UNIQUE") || t.is("CHECK") || t.is("FOREIGN")
+}
 
-					// data type length
-					matches := regRealDataType.FindAllStringSubmatch(columnType.DataTypeValue.String, -1)
-					if len(matches) == 1 && len(matches[0]) == 2 {
-						size, _ := strconv.Atoi(matches[0][1])
-						columnType.LengthValue = sql.NullInt64{Valid: true, Int64: int64(size)}
-						columnType.DataTypeValue.String = strings.TrimSuffix(columnType.DataTypeValue.String, matches[0][0])
-					}
+// columnConstraintStart tells whether the token starts a column
+// constraint, which ends the type name of a column.
+func columnConstraintStart(t token) bool {
+	for _, keyword := range []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT", "COLLATE", "REFERENCES", "GENERATED", "AS"} {
+		if t.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
 
-					result.columns = append(result.columns, columnType)
-				}
-			}
-		} else if matches := indexRegexp.FindStringSubmatch(str); len(matches) > 0 {
-			// don't report Unique by UniqueIndex
+func (p *ddlParser) parseColumn() (ddlColumn, error) {
+	start := p.pos
+	var column ddlColumn
+
+	name, err := p.expectName()
+	if err != nil {
+		return column, err
+	}
+	column.name = name
+
+	typeStart := p.pos
+	for t := p.peek(); t.kind == tokenWord && !columnConstraintStart(t); t = p.peek() {
+		p.next()
+	}
+	if p.pos > typeStart && p.peek().isPunct("(") {
+		if _, err := p.group(); err != nil {
+			return column, err
+		}
+	}
+	column.dataType = joinTokens(p.tokens[typeStart:p.pos])
+
+	for !p.eof() && !p.peek().isPunct(",") && !p.peek().isPunct(")") {
+		constraint, err := p.parseColumnConstraint()
+		if err != nil {
+			return column, err
+		}
+		column.constraints = append(column.constraints, constraint)
+	}
+
+	column.sql = joinTokens(p.tokens[start:p.pos])
+	return column, nil
+}
+
+func (p *ddlParser) parseColumnConstraint() (constraint ddlConstraint, err error) {
+	start := p.pos
+	if p.accept("CONSTRAINT") {
+		if constraint.name, err = p.expectName(); err != nil {
+			return
+		}
+	}
+
+	switch {
+	case p.accept("PRIMARY", "KEY"):
+		constraint.kind = constraintPrimaryKey
+		_ = p.accept("ASC") || p.accept("DESC")
+		if err = p.conflictClause(); err != nil {
+			return
+		}
+		constraint.autoIncrement = p.accept("AUTOINCREMENT")
+	case p.accept("NOT", "NULL"):
+		constraint.kind = constraintNotNull
+		err = p.conflictClause()
+	case p.accept("NULL"):
+		constraint.kind = constraintNull
+		err = p.conflictClause()
+	case p.accept("UNIQUE"):
+		constraint.kind = constraintUnique
+		err = p.conflictClause()
+	case p.accept("CHECK"):
+		constraint.kind = constraintCheck
+		var expr []token
+		expr, err = p.group()
+		constraint.expr = joinTokens(expr)
+	case p.accept("DEFAULT"):
+		constraint.kind = constraintDefault
+		constraint.expr, err = p.defaultValue()
+	case p.accept("COLLATE"):
+		constraint.kind = constraintCollate
+		constraint.expr, err = p.expectName()
+	case p.peek().is("REFERENCES"):
+		constraint.kind = constraintForeignKey
+		err = p.foreignKeyClause(&constraint)
+	case p.accept("GENERATED", "ALWAYS", "AS"), p.accept("AS"):
+		constraint.kind = constraintGenerated
+		var expr []token
+		if expr, err = p.group(); err != nil {
+			return
+		}
+		constraint.expr = joinTokens(expr)
+		if p.accept("STORED") {
+			constraint.stored = true
 		} else {
-			return nil, errors.New("invalid DDL")
+			p.accept("VIRTUAL")
 		}
+	default:
+		err = fmt.Errorf("unexpected %q in column definition", p.peek().text)
+		return
 	}
 
-	return &result, nil
+	constraint.sql = joinTokens(p.tokens[start:p.pos])
+	return
+}
+
+func (p *ddlParser) defaultValue() (string, error) {
+	if p.peek().isPunct("(") {
+		expr, err := p.group()
+		if err != nil {
+			return "", err
+		}
+		return joinTokens(expr), nil
+	}
+
+	start := p.pos
+	if p.peek().isPunct("+") || p.peek().isPunct("-") {
+		p.next()
+	}
+	switch t := p.next(); t.kind {
+	case tokenString, tokenNumber, tokenWord, tokenQuoted:
+		return joinTokens(p.tokens[start:p.pos]), nil
+	default:
+		return "", fmt.Errorf("invalid default value near %q", t.text)
+	}
+}
+
+// conflictClause consumes `ON CONFLICT algorithm`.
+func (p *ddlParser) conflictClause() error {
+	if !p.accept("ON", "CONFLICT") {
+		return nil
+	}
+	for _, algorithm := range []string{"ROLLBACK", "ABORT", "FAIL", "IGNORE", "REPLACE"} {
+		if p.accept(algorithm) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid conflict clause near %q", p.peek().text)
+}
+
+// columnList consumes `(name [COLLATE name] [ASC|DESC], ...)`, expressions
+// are skipped.
+func (p *ddlParser) columnList() ([]string, error) {
+	tokens, err := p.group()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		columns []string
+		first   = true
+		depth   int
+	)
+	for i, t := range tokens {
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		case t.isPunct(",") && depth == 0:
+			first = true
+			continue
+		}
+		if first && t.isName() {
+			// `name` alone or followed by COLLATE/ASC/DESC, not an expression
+			if i+1 == len(tokens) || tokens[i+1].isPunct(",") || tokens[i+1].is("COLLATE") || tokens[i+1].is("ASC") || tokens[i+1].is("DESC") {
+				columns = append(columns, t.name())
+			}
+		}
+		first = false
+	}
+	return columns, nil
+}
+
+// foreignKeyClause consumes `REFERENCES table [(columns)] [actions]`.
+func (p *ddlParser) foreignKeyClause(constraint *ddlConstraint) (err error) {
+	if err = p.expect("REFERENCES"); err != nil {
+		return
+	}
+	if constraint.expr, err = p.expectName(); err != nil {
+		return
+	}
+	if p.peek().isPunct("(") {
+		if _, err = p.columnList(); err != nil {
+			return
+		}
+	}
+
+	for {
+		switch {
+		case p.accept("ON"):
+			onDelete := p.accept("DELETE")
+			if !onDelete && !p.accept("UPDATE") {
+				return fmt.Errorf("invalid foreign key clause near %q", p.peek().text)
+			}
+			var action string
+			switch {
+			case p.accept("SET", "NULL"):
+				action = "SET NULL"
+			case p.accept("SET", "DEFAULT"):
+				action = "SET DEFAULT"
+			case p.accept("CASCADE"):
+				action = "CASCADE"
+			case p.accept("RESTRICT"):
+				action = "RESTRICT"
+			case p.accept("NO", "ACTION"):
+			default:
+				return fmt.Errorf("invalid foreign key action near %q", p.peek().text)
+			}
+			if onDelete {
+				constraint.onDelete = action
+			}
+		case p.accept("MATCH"):
+			if _, err = p.expectName(); err != nil {
+				return
+			}
+		case p.accept("NOT", "DEFERRABLE"), p.accept("DEFERRABLE"):
+			_ = p.accept("INITIALLY", "DEFERRED") || p.accept("INITIALLY", "IMMEDIATE")
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *ddlParser) parseTableConstraint() (constraint ddlConstraint, err error) {
+	start := p.pos
+	if p.accept("CONSTRAINT") {
+		if constraint.name, err = p.expectName(); err != nil {
+			return
+		}
+	}
+
+	switch {
+	case p.accept("PRIMARY", "KEY"):
+		constraint.kind = constraintPrimaryKey
+		if constraint.columns, err = p.columnList(); err != nil {
+			return
+		}
+		err = p.conflictClause()
+	case p.accept("UNIQUE"):
+		constraint.kind = constraintUnique
+		if constraint.columns, err = p.columnList(); err != nil {
+			return
+		}
+		err = p.conflictClause()
+	case p.accept("CHECK"):
+		constraint.kind = constraintCheck
+		var expr []token
+		expr, err = p.group()
+		constraint.expr = joinTokens(expr)
+	case p.accept("FOREIGN", "KEY"):
+		constraint.kind = constraintForeignKey
+		if constraint.columns, err = p.columnList(); err != nil {
+			return
+		}
+		err = p.foreignKeyClause(&constraint)
+	default:
+		err = fmt.Errorf("unexpected %q in table constraint", p.peek().text)
+	}
+	if err != nil {
+		return
+	}
+
+	constraint.sql = joinTokens(p.tokens[start:p.pos])
+	return
 }
 
 func (d *ddl) clone() *ddl {
 	copied := new(ddl)
 	*copied = *d
 
-	copied.fields = make([]string, len(d.fields))
-	copy(copied.fields, d.fields)
-	copied.columns = make([]migrator.ColumnType, len(d.columns))
-	copy(copied.columns, d.columns)
+	copied.columns = make([]ddlColumn, len(d.columns))
+	for i, column := range d.columns {
+		column.constraints = append([]ddlConstraint(nil), column.constraints...)
+		copied.columns[i] = column
+	}
+	copied.constraints = append([]ddlConstraint(nil), d.constraints...)
+	copied.options = append([]string(nil), d.options...)
 
 	return copied
 }
 
 func (d *ddl) compile() string {
-	if len(d.fields) == 0 {
-		return d.head
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if d.temporary {
+		b.WriteString("TEMPORARY ")
 	}
+	b.WriteString("TABLE ")
+	if d.ifNotExists {
+		b.WriteString("IF NOT EXISTS ")
+	}
+	if d.schema != "" {
+		b.WriteString(quoteIdent(d.schema) + ".")
+	}
+	b.WriteString(quoteIdent(d.table))
 
-	return fmt.Sprintf("%s (%s)", d.head, strings.Join(d.fields, ","))
-}
-
-func (d *ddl) renameTable(dst, src string) error {
-	tableReg, err := regexp.Compile("\\s*('|`|\")?\\b" + regexp.QuoteMeta(src) + "\\b('|`|\")?\\s*")
-	if err != nil {
-		return err
+	definitions := make([]string, 0, len(d.columns)+len(d.constraints))
+	for _, column := range d.columns {
+		definitions = append(definitions, column.sql)
 	}
+	for _, constraint := range d.constraints {
+		definitions = append(definitions, constraint.sql)
+	}
+	b.WriteString(" (" + strings.Join(definitions, ", ") + ")")
 
-	replaced := tableReg.ReplaceAllString(d.head, fmt.Sprintf(" `%s` ", dst))
-	if replaced == d.head {
-		return fmt.Errorf("failed to look up tablename `%s` from DDL head '%s'", src, d.head)
+	if len(d.options) > 0 {
+		b.WriteString(" " + strings.Join(d.options, ", "))
 	}
+	return b.String()
+}
 
-	d.head = replaced
+func (d *ddl) renameTable(dst, src string) error {
+	if !strings.EqualFold(d.table, src) {
+		return fmt.Errorf("failed to look up tablename `%s` from DDL of `%s`", src, d.table)
+	}
+	d.table = dst
 	return nil
 }
 
+// addConstraint adds a table constraint given as sql, replacing the one
+// with the same name.
 func (d *ddl) addConstraint(name string, sql string) {
-	reg := regexp.MustCompile("^CONSTRAINT [\"`]?" + regexp.QuoteMeta(name) + "[\"` ]")
-
-	for i := 0; i < len(d.fields); i++ {
-		if reg.MatchString(d.fields[i]) {
-			d.fields[i] = sql
+	for i := range d.constraints {
+		if strings.EqualFold(d.constraints[i].name, name) {
+			d.constraints[i] = ddlConstraint{name: name, sql: sql}
 			return
 		}
 	}
-
-	d.fields = append(d.fields, sql)
+	d.constraints = append(d.constraints, ddlConstraint{name: name, sql: sql})
 }
 
+// removeConstraint removes the named table constraint, or the named
+// constraint of a column.
 func (d *ddl) removeConstraint(name string) bool {
-	reg := regexp.MustCompile("^CONSTRAINT [\"`]?" + regexp.QuoteMeta(name) + "[\"` ]")
-
-	for i := 0; i < len(d.fields); i++ {
-		if reg.MatchString(d.fields[i]) {
-			d.fields = append(d.fields[:i], d.fields[i+1:]...)
+	for i := range d.constraints {
+		if strings.EqualFold(d.constraints[i].name, name) {
+			d.constraints = append(d.constraints[:i], d.constraints[i+1:]...)
 			return true
 		}
 	}
+	for i := range d.columns {
+		column := &d.columns[i]
+		for j := range column.constraints {
+			if strings.EqualFold(column.constraints[j].name, name) {
+				column.constraints = append(column.constraints[:j], column.constraints[j+1:]...)
+				column.sql = column.compile()
+				return true
+			}
+		}
+	}
 	return false
 }
 
 func (d *ddl) hasConstraint(name string) bool {
-	reg := regexp.MustCompile("^CONSTRAINT [\"`]?" + regexp.QuoteMeta(name) + "[\"` ]")
-
-	for _, f := range d.fields {
-		if reg.MatchString(f) {
+	for _, constraint := range d.constraints {
+		if strings.EqualFold(constraint.name, name) {
 			return true
 		}
 	}
+	for _, column := range d.columns {
+		for _, constraint := range column.constraints {
+			if strings.EqualFold(constraint.name, name) {
+				return true
+			}
+		}
+	}
 	return false
 }
 
-func (d *ddl) getColumns() []string {
-	res := []string{}
+// compile renders the column from its parsed parts.
+func (c *ddlColumn) compile() string {
+	parts := []string{quoteIdent(c.name)}
+	if c.dataType != "" {
+		parts = append(parts, c.dataType)
+	}
+	for _, constraint := range c.constraints {
+		parts = append(parts, constraint.sql)
+	}
+	return strings.Join(parts, " ")
+}
 
-	for _, f := range d.fields {
-		fUpper := strings.ToUpper(f)
-		if strings.HasPrefix(fUpper, "PRIMARY KEY") ||
-			strings.HasPrefix(fUpper, "CHECK") ||
-			strings.HasPrefix(fUpper, "CONSTRAINT") ||
-			strings.Contains(fUpper, "GENERATED ALWAYS AS") {
-			continue
+func (d *ddl) column(name string) *ddlColumn {
+	for i := range d.columns {
+		if strings.EqualFold(d.columns[i].name, name) {
+			return &d.columns[i]
 		}
+	}
+	return nil
+}
 
-		reg := regexp.MustCompile("^[\"`']?([\\w\\d]+)[\"`']?")
-		match := reg.FindStringSubmatch(f)
-
-		if match != nil {
-			res = append(res, "`"+match[1]+"`")
+// getColumns returns the quoted names of the columns holding data,
+// generated columns are left out.
+func (d *ddl) getColumns() []string {
+	res := []string{}
+	for _, column := range d.columns {
+		if !column.generated() {
+			res = append(res, quoteIdent(column.name))
 		}
 	}
 	return res
 }
 
 func (d *ddl) removeColumn(name string) bool {
-	reg := regexp.MustCompile("^(`|'|\"| )" + regexp.QuoteMeta(name) + "(`|'|\"| ) .*?$")
-
-	for i := 0; i < len(d.fields); i++ {
-		if reg.MatchString(d.fields[i]) {
-			d.fields = append(d.fields[:i], d.fields[i+1:]...)
+	for i := range d.columns {
+		if strings.EqualFold(d.columns[i].name, name) {
+			d.columns = append(d.columns[:i], d.columns[i+1:]...)
 			return true
 		}
 	}
-
 	return false
 }
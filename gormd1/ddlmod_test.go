@@ -0,0 +1,161 @@
+package gormd1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ddlCorpus holds DDL as stored in sqlite_master by gorm, wrangler, D1
+// itself and hand written schemas.
+var ddlCorpus = []string{
+	// gorm
+	"CREATE TABLE `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`name` text UNIQUE,`age` integer,`active` numeric,`wallet` real,`bin` blob)",
+	"CREATE TABLE `members` (`id` integer,`org_id` integer NOT NULL,`email` text NOT NULL,`name` text,PRIMARY KEY (`id`))",
+	"CREATE TABLE `tickets` (`id` integer PRIMARY KEY AUTOINCREMENT,`title` text,`status` text DEFAULT \"open\")",
+	"CREATE TABLE `legacy_flags` (`id` integer PRIMARY KEY, `enabled` string)",
+	"CREATE TABLE `flags` (`id` integer,`enabled` integer CHECK (`enabled` IN (0, 1)),PRIMARY KEY (`id`))",
+	"CREATE TABLE `orders` (`id` integer,`user_id` integer,`amount` decimal(10,2),PRIMARY KEY (`id`),CONSTRAINT `fk_users_orders` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE ON UPDATE CASCADE)",
+	"CREATE TABLE `profiles` (`id` integer,`user_id` integer,`bio` text,PRIMARY KEY (`id`),CONSTRAINT `uni_profiles_user_id` UNIQUE (`user_id`),CONSTRAINT `chk_profiles_bio` CHECK (length(bio) < 1000))",
+	"CREATE TABLE `users__temp` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text)",
+	// wrangler and D1
+	"CREATE TABLE d1_migrations(\n\t\tid         INTEGER PRIMARY KEY AUTOINCREMENT,\n\t\tname       TEXT UNIQUE,\n\t\tapplied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL\n)",
+	"CREATE TABLE _cf_KV (\n        key TEXT PRIMARY KEY,\n        value BLOB\n      ) WITHOUT ROWID",
+	"CREATE TABLE _cf_METADATA (key INTEGER PRIMARY KEY, value BLOB)",
+	// hand written
+	"CREATE TABLE t1(a, b, c)",
+	"CREATE TABLE IF NOT EXISTS main.t2 (x INTEGER NOT NULL ON CONFLICT REPLACE, y TEXT COLLATE NOCASE)",
+	"CREATE TEMP TABLE scratch (k TEXT PRIMARY KEY DESC ON CONFLICT IGNORE, v ANY) STRICT",
+	"CREATE TABLE \"order items\" (\"item-id\" INTEGER, \"order id\" INTEGER, [qty] INTEGER DEFAULT 1, PRIMARY KEY (\"order id\", \"item-id\")) WITHOUT ROWID, STRICT",
+	"CREATE TABLE `we``ird` (`col``umn` TEXT, 'single quoted' TEXT)",
+	"CREATE TABLE prices (\n  id INTEGER PRIMARY KEY, -- the id\n  /* amounts are in cents */ amount INTEGER NOT NULL CHECK (amount >= 0 AND (amount % 5) = 0),\n  currency TEXT NOT NULL DEFAULT 'USD' CHECK (currency IN ('USD', 'EUR', '(x)')),\n  note TEXT DEFAULT 'it''s, fine'\n)",
+	"CREATE TABLE events (id INTEGER PRIMARY KEY, payload TEXT, kind TEXT GENERATED ALWAYS AS (json_extract(payload, '$.kind')) VIRTUAL, size INTEGER AS (length(payload)) STORED)",
+	"CREATE TABLE readings (id INTEGER PRIMARY KEY, value REAL DEFAULT -1.5e3, mask INTEGER DEFAULT 0xff, raw BLOB DEFAULT x'00ff', at DATETIME DEFAULT (datetime('now')))",
+	"CREATE TABLE types (a UNSIGNED BIG INT, b VARYING CHARACTER(255), c NATIVE CHARACTER (70), d DOUBLE PRECISION, e DECIMAL(10, 5), f BOOLEAN)",
+	"CREATE TABLE children (id INTEGER PRIMARY KEY, parent_id INTEGER REFERENCES parents(id) ON DELETE SET NULL DEFERRABLE INITIALLY DEFERRED, other_id INTEGER CONSTRAINT fk_other REFERENCES others MATCH SIMPLE)",
+	"CREATE TABLE links (a INTEGER, b INTEGER, FOREIGN KEY (a, b) REFERENCES pairs (x, y) ON UPDATE NO ACTION NOT DEFERRABLE, UNIQUE (a COLLATE NOCASE ASC, b DESC) ON CONFLICT ABORT, CHECK (a <> b))",
+	"CREATE TABLE ops (id INTEGER PRIMARY KEY, doc TEXT, CHECK (doc ->> '$.v' >= 1 AND doc -> '$.w' IS NOT NULL AND (id << 1) != 3 AND 'a' || 'b' == 'ab'))",
+	"CREATE TABLE keyword_names (\"key\" TEXT, \"order\" INTEGER, \"check\" TEXT, `default` TEXT, [primary] INTEGER)",
+	"CREATE TABLE nulls (a TEXT NULL, b TEXT CONSTRAINT nn NOT NULL, c TEXT CONSTRAINT d DEFAULT NULL, d INTEGER DEFAULT +1, e TEXT DEFAULT TRUE);",
+	"CREATE TABLE `accounts` (`id` integer,`email` text NOT NULL,`org` text,PRIMARY KEY (`id`),CONSTRAINT `uni_accounts_email_org` UNIQUE (lower(`email`), `org`))",
+}
+
+func TestParseDDLCorpus(t *testing.T) {
+	for _, sql := range ddlCorpus {
+		t.Run(sql, func(t *testing.T) {
+			parsed, err := parseDDL(sql)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			compiled := parsed.compile()
+			reparsed, err := parseDDL(compiled)
+			if !assert.Nilf(t, err, "reparse %s", compiled) {
+				return
+			}
+			assert.Equal(t, parsed, reparsed, "round trip")
+			assert.Equal(t, compiled, reparsed.compile(), "stable")
+		})
+	}
+}
+
+func TestParseDDL(t *testing.T) {
+	parsed, err := parseDDL(ddlCorpus[16])
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "prices", parsed.table)
+	assert.Equal(t, []string{"`id`", "`amount`", "`currency`", "`note`"}, parsed.getColumns())
+	assert.Equal(t, "amount INTEGER NOT NULL CHECK (amount >= 0 AND (amount % 5) = 0)", parsed.columns[1].sql)
+	assert.Equal(t, "amount >= 0 AND (amount % 5) = 0", parsed.column("amount").constraint(constraintCheck).expr)
+	assert.Equal(t, "'USD'", parsed.column("currency").constraint(constraintDefault).expr)
+	assert.Equal(t, "'it''s, fine'", parsed.column("note").constraint(constraintDefault).expr)
+
+	parsed, err = parseDDL(ddlCorpus[14])
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "order items", parsed.table)
+	assert.Equal(t, []string{"item-id", "order id", "qty"}, []string{parsed.columns[0].name, parsed.columns[1].name, parsed.columns[2].name})
+	assert.Equal(t, []string{"order id", "item-id"}, parsed.constraints[0].columns)
+	assert.Equal(t, []string{"WITHOUT ROWID", "STRICT"}, parsed.options)
+	assert.Equal(t, "CREATE TABLE `order items` (\"item-id\" INTEGER, \"order id\" INTEGER, [qty] INTEGER DEFAULT 1, PRIMARY KEY (\"order id\", \"item-id\")) WITHOUT ROWID, STRICT", parsed.compile())
+
+	parsed, err = parseDDL(ddlCorpus[17])
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"`id`", "`payload`"}, parsed.getColumns(), "generated columns hold no data")
+	assert.True(t, parsed.column("size").constraint(constraintGenerated).stored)
+	assert.Equal(t, "json_extract(payload, '$.kind')", parsed.column("kind").constraint(constraintGenerated).expr)
+
+	parsed, err = parseDDL(ddlCorpus[19])
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"UNSIGNED BIG INT", "VARYING CHARACTER(255)", "NATIVE CHARACTER (70)", "DOUBLE PRECISION", "DECIMAL(10, 5)", "BOOLEAN"},
+		[]string{parsed.columns[0].dataType, parsed.columns[1].dataType, parsed.columns[2].dataType, parsed.columns[3].dataType, parsed.columns[4].dataType, parsed.columns[5].dataType})
+
+	parsed, err = parseDDL(ddlCorpus[0])
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, parsed.column("id").constraint(constraintPrimaryKey).autoIncrement)
+	assert.NotNil(t, parsed.column("name").constraint(constraintUnique))
+
+	parsed, err = parseDDL(ddlCorpus[25])
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"org"}, parsed.constraints[1].columns, "expressions are left out")
+}
+
+func TestParseDDLErrors(t *testing.T) {
+	for _, sql := range []string{
+		"CREATE TABLE t (a TEXT",
+		"CREATE TABLE t (a TEXT CHECK (a > 0)",
+		"CREATE TABLE t (a TEXT DEFAULT 'x)",
+		"CREATE TABLE t (a TEXT) /* comment",
+		"CREATE TABLE t AS SELECT 1",
+		"CREATE TABLE t ()",
+		"CREATE TABLE t (PRIMARY KEY (a), a TEXT)",
+		"CREATE TABLE t (a TEXT) WITHOUT",
+		"CREATE INDEX idx ON t (a)",
+	} {
+		_, err := parseDDL(sql)
+		assert.NotNilf(t, err, sql)
+	}
+}
+
+func TestDDLModify(t *testing.T) {
+	parsed, err := parseDDL(ddlCorpus[6])
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	copied := parsed.clone()
+	assert.Nil(t, copied.renameTable("profiles__temp", "profiles"))
+	assert.NotNil(t, copied.renameTable("x", "profiles"))
+	assert.True(t, copied.hasConstraint("uni_profiles_user_id"))
+	assert.True(t, copied.removeConstraint("uni_profiles_user_id"))
+	assert.False(t, copied.hasConstraint("uni_profiles_user_id"))
+	copied.addConstraint("chk_profiles_bio", "CONSTRAINT `chk_profiles_bio` CHECK (length(bio) < 500)")
+	copied.addConstraint("fk_x", "CONSTRAINT ? FOREIGN KEY ? REFERENCES ??")
+	assert.True(t, copied.removeColumn("bio"))
+	assert.False(t, copied.removeColumn("bio"))
+
+	assert.Equal(t,
+		"CREATE TABLE `profiles__temp` (`id` integer, `user_id` integer, PRIMARY KEY (`id`), CONSTRAINT `chk_profiles_bio` CHECK (length(bio) < 500), CONSTRAINT ? FOREIGN KEY ? REFERENCES ??)",
+		copied.compile(),
+	)
+	assert.Equal(t, "profiles", parsed.table, "clone is independent")
+	assert.Len(t, parsed.columns, 3)
+	assert.Len(t, parsed.constraints, 3)
+
+	parsed, err = parseDDL(ddlCorpus[24])
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, parsed.removeConstraint("nn"), "named column constraint")
+	assert.Equal(t, "`b` TEXT", parsed.column("b").sql)
+}
@@ -0,0 +1,134 @@
+package gormd1
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	d1 "github.com/kofj/gorm-driver-d1"
+	"github.com/kofj/gorm-driver-d1/stdlib"
+)
+
+// DestructivePolicy decides on migrations which drop tables, drop columns
+// or rebuild tables.
+type DestructivePolicy string
+
+const (
+	// DestructiveDeny fails destructive migrations with
+	// ErrDestructiveMigration, it's the default of production databases.
+	DestructiveDeny DestructivePolicy = "deny"
+	// DestructiveAllow runs destructive migrations, it's the default of
+	// other databases.
+	DestructiveAllow DestructivePolicy = "allow"
+	// DestructiveBackup runs destructive migrations once the affected
+	// table is backed up.
+	DestructiveBackup DestructivePolicy = "backup"
+)
+
+var ErrDestructiveMigration = errors.New("destructive migration denied")
+
+// backupTimeFormat stamps the names of backup tables.
+const backupTimeFormat = "20060102150405"
+
+// Backup is taken before a destructive migration with DestructiveBackup.
+type Backup struct {
+	// Operation is "drop table", "drop column" or "rebuild table".
+	Operation string
+	Table     string
+	// Bookmark is the time travel bookmark of the database before the
+	// change, see https://developers.cloudflare.com/d1/reference/time-travel/
+	Bookmark string
+	// BackupTable holds a copy of the rows of the table, like
+	// `_backup_users_20240102030405`. It's empty when the rows were
+	// exported with Config.ExportBackup.
+	BackupTable string
+}
+
+// destructive applies the destructive policy to the operation on the
+// table, which may back up the table.
+func (m Migrator) destructive(operation, table string) error {
+	if m.recorder() != nil {
+		// recorded statements are reviewed and applied later
+		return nil
+	}
+
+	config := m.config()
+	policy := config.DestructivePolicy
+	if policy == "" {
+		policy = DestructiveAllow
+		if config.Production {
+			policy = DestructiveDeny
+		}
+	}
+	if policy == DestructiveAllow {
+		return nil
+	}
+
+	rawDDL, err := m.getRawDDL(table)
+	if err != nil || rawDDL == "" {
+		return err
+	}
+	switch policy {
+	case DestructiveDeny:
+		return fmt.Errorf("%w: %s %s", ErrDestructiveMigration, operation, table)
+	case DestructiveBackup:
+		return m.backup(operation, table, rawDDL)
+	}
+	return errors.New("invalid destructive policy specified: " + string(policy))
+}
+
+// backup records the time travel bookmark of the database and copies the
+// rows of the table into a backup table, or exports them.
+func (m Migrator) backup(operation, table, rawDDL string) error {
+	backup := Backup{Operation: operation, Table: table}
+	if _, err := m.withConn(func(c *stdlib.Conn) (err error) {
+		backup.Bookmark, err = c.TimeTravelBookmarkContext(m.context())
+		return err
+	}); err != nil {
+		return err
+	}
+
+	config := m.config()
+	if config.ExportBackup != nil {
+		rows, err := m.DB.Raw(fmt.Sprintf("SELECT * FROM %s", quoteIdent(table))).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		if err := config.ExportBackup(table, rows); err != nil {
+			return err
+		}
+	} else {
+		backup.BackupTable = fmt.Sprintf("_backup_%s_%s", table, time.Now().UTC().Format(backupTimeFormat))
+		if err := m.copyTable(table, rawDDL, backup.BackupTable); err != nil {
+			return err
+		}
+	}
+
+	d1.Trace("%s %s: backed up to %q, bookmark %s", operation, table, backup.BackupTable, backup.Bookmark)
+	if config.OnBackup != nil {
+		config.OnBackup(backup)
+	}
+	return nil
+}
+
+// copyTable copies the rows of the table into a new table without any of
+// its constraints, which would tie the copy to other tables.
+func (m Migrator) copyTable(table, rawDDL, dst string) error {
+	if err := m.DB.Exec(fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s WHERE 0", quoteIdent(dst), quoteIdent(table))).Error; err != nil {
+		return err
+	}
+	originDDL, err := parseDDL(rawDDL)
+	if err != nil {
+		return err
+	}
+	dstSQL, err := m.getRawDDL(dst)
+	if err != nil {
+		return err
+	}
+	dstDDL, err := parseDDL(dstSQL)
+	if err != nil {
+		return err
+	}
+	return m.copyRows(table, originDDL, dstDDL)
+}
@@ -0,0 +1,122 @@
+package gormd1
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	d1 "github.com/kofj/gorm-driver-d1"
+
+	"gorm.io/gorm"
+)
+
+var _ gorm.ErrorTranslator = (*Dialector)(nil)
+
+// Kinds of constraints reported by SQLite.
+const (
+	ConstraintUnique     = "UNIQUE"
+	ConstraintPrimaryKey = "PRIMARY KEY"
+	ConstraintNotNull    = "NOT NULL"
+	ConstraintCheck      = "CHECK"
+	ConstraintForeignKey = "FOREIGN KEY"
+)
+
+// e.g. `UNIQUE constraint failed: users.email: SQLITE_CONSTRAINT`,
+// `FOREIGN KEY constraint failed: SQLITE_CONSTRAINT`
+var constraintFailedRegexp = regexp.MustCompile(`(UNIQUE|PRIMARY KEY|NOT NULL|CHECK|FOREIGN KEY) constraint failed(?::\s*(.*?))?(?::\s*SQLITE_\w+)?\s*$`)
+
+// ConstraintError is returned by Translate for statements violating a
+// constraint, it matches the gorm error of its kind with errors.Is, e.g.
+// gorm.ErrDuplicatedKey for unique violations.
+type ConstraintError struct {
+	// Kind is one of the Constraint* constants.
+	Kind  string
+	Table string
+	// Columns violating a UNIQUE or NOT NULL constraint.
+	Columns []string
+	// Constraint is the name or expression of a violated CHECK constraint.
+	Constraint string
+
+	Err error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConstraintError) Unwrap() []error {
+	if translated := e.translated(); translated != nil {
+		return []error{translated, e.Err}
+	}
+	return []error{e.Err}
+}
+
+func (e *ConstraintError) translated() error {
+	switch e.Kind {
+	case ConstraintUnique, ConstraintPrimaryKey:
+		return gorm.ErrDuplicatedKey
+	case ConstraintForeignKey:
+		return gorm.ErrForeignKeyViolated
+	case ConstraintCheck:
+		return gorm.ErrCheckConstraintViolated
+	}
+	return nil
+}
+
+// Translate implements gorm.ErrorTranslator, it's used with
+// gorm.Config.TranslateError enabled.
+func (dialector Dialector) Translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var messages []string
+	var apiErr *d1.APIError
+	if errors.As(err, &apiErr) {
+		for _, e := range apiErr.Errors {
+			messages = append(messages, e.Message)
+		}
+	} else {
+		messages = strings.Split(err.Error(), "\n")
+	}
+
+	for _, message := range messages {
+		if constraintErr := parseConstraintError(message); constraintErr != nil {
+			constraintErr.Err = err
+			return constraintErr
+		}
+	}
+	return err
+}
+
+func parseConstraintError(message string) *ConstraintError {
+	matches := constraintFailedRegexp.FindStringSubmatch(strings.TrimRight(message, "'"))
+	if matches == nil {
+		return nil
+	}
+
+	constraintErr := &ConstraintError{Kind: matches[1]}
+	details := strings.TrimSpace(matches[2])
+	switch constraintErr.Kind {
+	case ConstraintCheck:
+		constraintErr.Constraint = details
+	case ConstraintForeignKey:
+		// SQLite doesn't tell which foreign key failed
+	default:
+		// `table.column[, table.column...]`, or `index 'name'` for
+		// expression indexes
+		if strings.HasPrefix(details, "index ") {
+			constraintErr.Constraint = strings.Trim(strings.TrimPrefix(details, "index "), "'")
+			break
+		}
+		for _, column := range strings.Split(details, ",") {
+			table, name, ok := strings.Cut(strings.TrimSpace(column), ".")
+			if !ok {
+				continue
+			}
+			constraintErr.Table = table
+			constraintErr.Columns = append(constraintErr.Columns, name)
+		}
+	}
+	return constraintErr
+}
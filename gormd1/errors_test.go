@@ -0,0 +1,58 @@
+package gormd1
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	d1 "github.com/kofj/gorm-driver-d1"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTranslate(t *testing.T) {
+	dialector := Dialector{}
+
+	apiErr := func(message string) error {
+		return &d1.APIError{StatusCode: http.StatusBadRequest, Errors: []d1.D1RespError{{Code: 7500, Message: message}}}
+	}
+
+	var tests = []struct {
+		err      error
+		expected error
+		kind     string
+		table    string
+		columns  []string
+		named    string
+	}{
+		{apiErr("UNIQUE constraint failed: users.email: SQLITE_CONSTRAINT"), gorm.ErrDuplicatedKey, ConstraintUnique, "users", []string{"email"}, ""},
+		{apiErr("D1_ERROR: UNIQUE constraint failed: members.org_id, members.email: SQLITE_CONSTRAINT"), gorm.ErrDuplicatedKey, ConstraintUnique, "members", []string{"org_id", "email"}, ""},
+		{apiErr("PRIMARY KEY constraint failed: users.id"), gorm.ErrDuplicatedKey, ConstraintPrimaryKey, "users", []string{"id"}, ""},
+		{apiErr("FOREIGN KEY constraint failed: SQLITE_CONSTRAINT"), gorm.ErrForeignKeyViolated, ConstraintForeignKey, "", nil, ""},
+		{apiErr("CHECK constraint failed: chk_users_age: SQLITE_CONSTRAINT"), gorm.ErrCheckConstraintViolated, ConstraintCheck, "", nil, "chk_users_age"},
+		{errors.New("[0] code: 7500, message: 'NOT NULL constraint failed: users.name: SQLITE_CONSTRAINT'"), nil, ConstraintNotNull, "users", []string{"name"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err.Error(), func(t *testing.T) {
+			err := dialector.Translate(test.err)
+			var constraintErr *ConstraintError
+			if !assert.ErrorAs(t, err, &constraintErr) {
+				return
+			}
+			if test.expected != nil {
+				assert.ErrorIs(t, err, test.expected)
+			}
+			assert.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.err.Error(), err.Error())
+			assert.Equal(t, test.kind, constraintErr.Kind)
+			assert.Equal(t, test.table, constraintErr.Table)
+			assert.Equal(t, test.columns, constraintErr.Columns)
+			assert.Equal(t, test.named, constraintErr.Constraint)
+		})
+	}
+
+	other := apiErr("no such table: users: SQLITE_ERROR")
+	assert.Equal(t, other, dialector.Translate(other))
+	assert.Nil(t, dialector.Translate(nil))
+}
@@ -3,6 +3,9 @@ package gormd1
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	nurl "net/url"
+	"strconv"
 	"strings"
 
 	d1 "github.com/kofj/gorm-driver-d1"
@@ -15,17 +18,77 @@ import (
 	"gorm.io/gorm/schema"
 )
 
-type Dialector struct {
-	dsn  string
+// Config of the dialector, options affecting the driver are passed on as
+// dsn options, overriding the ones of DSN, and are ignored when Conn is set.
+type Config struct {
+	// DriverName is the database/sql driver to open DSN with, defaults to d1.
+	DriverName string
+	DSN        string
+	// Conn is used instead of opening DSN, e.g. a *sql.DB opened with
+	// sql.OpenDB(stdlib.NewConnector(dsn)).
 	Conn gorm.ConnPool
-	ctx  context.Context
-	log  logger.Interface
+
+	// DefaultTimeFormat is the layout times are stored with, defaults to
+	// time.RFC3339Nano.
+	DefaultTimeFormat string
+	// MaxParamsPerStatement overrides D1's limit of bound params per
+	// statement, checked before statements are sent.
+	MaxParamsPerStatement int
+	// TransactionMode decides how statements within transactions are sent.
+	TransactionMode d1.TransactionMode
+	// DisableReturning falls back to LastInsertId instead of RETURNING,
+	// which only yields the id of the last row of a batch insert.
+	// RETURNING is always disabled when the connections use
+	// d1.TransactionBatch, whether set here, by the dsn or by Conn.
+	DisableReturning bool
+
+	// BoolCheck adds a CHECK constraint to bool columns, limiting them to 0 and 1.
+	BoolCheck bool
+
+	// RebuildChunkSize is the number of rows copied per statement when the
+	// migrator rebuilds a table, defaults to 10000. Rows inserted during
+	// the copy are caught up when the tables are swapped, rows updated or
+	// deleted meanwhile are not.
+	RebuildChunkSize int
+	// RebuildProgress is called after every chunk copied by a rebuild.
+	RebuildProgress func(table string, copied, total int64)
+	// DropDependents lets rebuilds dropping columns drop the views and
+	// triggers mentioning them, instead of failing with ErrColumnInUse.
+	DropDependents bool
+
+	// Production denies migrations dropping tables, dropping columns or
+	// rebuilding tables unless DestructivePolicy allows them.
+	Production bool
+	// DestructivePolicy decides on migrations dropping tables, dropping
+	// columns or rebuilding tables, defaults to DestructiveDeny in
+	// production and to DestructiveAllow otherwise.
+	DestructivePolicy DestructivePolicy
+	// ExportBackup exports the rows of a table with DestructiveBackup,
+	// instead of copying them into a _backup_ table.
+	ExportBackup func(table string, rows *sql.Rows) error
+	// OnBackup is called with every backup taken, e.g. to log its bookmark.
+	OnBackup func(backup Backup)
+}
+
+type Dialector struct {
+	*Config
+	// Conn and BoolCheck are kept for dialectors built without a Config,
+	// like &Dialector{Conn: db}, they are merged into the Config.
+	Conn      gorm.ConnPool
+	BoolCheck bool
+
+	ctx context.Context
+	log logger.Interface
 }
 
 var _ gorm.Dialector = (*Dialector)(nil)
 
 func Open(dsn string) gorm.Dialector {
-	return &Dialector{dsn: dsn, ctx: context.Background()}
+	return &Dialector{Config: &Config{DSN: dsn}, ctx: context.Background()}
+}
+
+func New(config Config) gorm.Dialector {
+	return &Dialector{Config: &config, ctx: context.Background()}
 }
 
 func (dialector Dialector) Name() string {
@@ -33,29 +96,203 @@ func (dialector Dialector) Name() string {
 }
 
 func (dialector *Dialector) Initialize(db *gorm.DB) (err error) {
+	if dialector.Config == nil {
+		dialector.Config = &Config{}
+	}
+	if dialector.Conn != nil {
+		dialector.Config.Conn = dialector.Conn
+	}
+	dialector.Conn = dialector.Config.Conn
+	dialector.Config.BoolCheck = dialector.Config.BoolCheck || dialector.BoolCheck
+	dialector.BoolCheck = dialector.Config.BoolCheck
+	if dialector.ctx == nil {
+		dialector.ctx = context.Background()
+	}
 	dialector.log = db.Logger
 
-	// register callbacks
-	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{
-		LastInsertIDReversed: true,
-	})
-
 	if dialector.Conn != nil {
 		db.ConnPool = dialector.Conn
 	} else {
-		db.ConnPool, err = sql.Open(d1.DriverName, dialector.dsn)
+		driverName := dialector.DriverName
+		if driverName == "" {
+			driverName = d1.DriverName
+		}
+		db.ConnPool, err = sql.Open(driverName, dialector.dsnWithOptions())
 		if err != nil {
 			return err
 		}
 	}
 
+	// register callbacks
+	callbackConfig := &callbacks.Config{
+		LastInsertIDReversed: true,
+	}
+	// writes with RETURNING are sent as queries, which batch transactions
+	// refuse as they would escape the buffered statements
+	if !dialector.DisableReturning {
+		mode, err := dialector.transactionMode()
+		if err != nil {
+			// LastInsertId works with any mode
+			d1.Trace("RETURNING disabled, failed to get the transaction mode: %s", err)
+		}
+		if err == nil && mode != d1.TransactionBatch {
+			callbackConfig.CreateClauses = []string{"INSERT", "VALUES", "ON CONFLICT", "RETURNING"}
+			callbackConfig.UpdateClauses = []string{"UPDATE", "SET", "FROM", "WHERE", "RETURNING"}
+			callbackConfig.DeleteClauses = []string{"DELETE", "FROM", "WHERE", "RETURNING"}
+		}
+	}
+	callbacks.RegisterDefaultCallbacks(db, callbackConfig)
+
+	for k, v := range dialector.ClauseBuilders() {
+		db.ClauseBuilders[k] = v
+	}
+
 	return nil
 }
 
+// transactionMode returns the transaction mode of the connections. It's
+// set by the dsn, or asked from a connection of Conn as TransactionMode is
+// ignored then.
+func (dialector Dialector) transactionMode() (d1.TransactionMode, error) {
+	if dialector.Conn == nil {
+		u, err := nurl.Parse(dialector.dsnWithOptions())
+		if err != nil {
+			return "", err
+		}
+		return d1.TransactionMode(u.Query().Get("tx")), nil
+	}
+
+	sqlDB, ok := dialector.Conn.(*sql.DB)
+	if !ok {
+		return dialector.TransactionMode, nil
+	}
+	conn, err := sqlDB.Conn(dialector.ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	mode := dialector.TransactionMode
+	err = conn.Raw(func(driverConn interface{}) error {
+		if c, ok := driverConn.(interface{ TransactionMode() d1.TransactionMode }); ok {
+			mode = c.TransactionMode()
+		}
+		return nil
+	})
+	return mode, err
+}
+
+// dsnWithOptions sets the driver options of the config in the dsn, they
+// take precedence over the options already present in the dsn.
+func (dialector Dialector) dsnWithOptions() string {
+	var options = nurl.Values{}
+	if dialector.DefaultTimeFormat != "" {
+		options.Set("time_format", dialector.DefaultTimeFormat)
+	}
+	if dialector.MaxParamsPerStatement != 0 {
+		options.Set("max_params", strconv.Itoa(dialector.MaxParamsPerStatement))
+	}
+	if dialector.TransactionMode != "" {
+		options.Set("tx", string(dialector.TransactionMode))
+	}
+	if len(options) == 0 {
+		return dialector.DSN
+	}
+
+	u, err := nurl.Parse(dialector.DSN)
+	if err != nil {
+		// let the driver report the invalid dsn
+		return dialector.DSN
+	}
+	query := u.Query()
+	for key := range options {
+		query.Set(key, options.Get(key))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// insertModifiers maps modifiers of other databases to SQLite's conflict
+// resolution of INSERT.
+var insertModifiers = map[string]string{
+	"IGNORE":  "OR IGNORE",
+	"REPLACE": "OR REPLACE",
+}
+
+func (dialector Dialector) ClauseBuilders() map[string]clause.ClauseBuilder {
+	return map[string]clause.ClauseBuilder{
+		"INSERT": func(c clause.Clause, builder clause.Builder) {
+			if insert, ok := c.Expression.(clause.Insert); ok {
+				if modifier, ok := insertModifiers[strings.ToUpper(strings.TrimSpace(insert.Modifier))]; ok {
+					insert.Modifier = modifier
+					c.Expression = insert
+				}
+			}
+			c.Build(builder)
+		},
+		"ON CONFLICT": func(c clause.Clause, builder clause.Builder) {
+			onConflict, ok := c.Expression.(clause.OnConflict)
+			stmt, isStmt := builder.(*gorm.Statement)
+			if !ok || !isStmt || onConflict.OnConstraint == "" {
+				c.Build(builder)
+				return
+			}
+
+			// SQLite has no ON CONSTRAINT, target the columns of the constraint instead
+			columns, err := uniqueColumns(stmt, onConflict.OnConstraint)
+			if err != nil {
+				stmt.AddError(err)
+				return
+			}
+			onConflict.OnConstraint = ""
+			onConflict.Columns = columns
+			c.Expression = onConflict
+			c.Build(builder)
+		},
+	}
+}
+
+// uniqueColumns returns the columns of the unique constraint or unique
+// index with the given name.
+func uniqueColumns(stmt *gorm.Statement, name string) ([]clause.Column, error) {
+	if stmt.Schema != nil {
+		if constraint, ok := stmt.Schema.ParseUniqueConstraints()[name]; ok {
+			return []clause.Column{{Name: constraint.Field.DBName}}, nil
+		}
+		if idx := stmt.Schema.LookIndex(name); idx != nil && idx.Class == "UNIQUE" {
+			columns := make([]clause.Column, 0, len(idx.Fields))
+			for _, field := range idx.Fields {
+				columns = append(columns, clause.Column{Name: field.DBName})
+			}
+			return columns, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to find unique constraint or index with name %v", name)
+}
+
+// DataTypeOf returns the declared type of the field, followed by the
+// GENERATED ALWAYS clause of generated columns.
 func (dialector Dialector) DataTypeOf(field *schema.Field) string {
+	return dialector.tableDataTypeOf(field, strictSchema(field.Schema))
+}
+
+// tableDataTypeOf is DataTypeOf for a table which strict tells whether
+// it's STRICT.
+func (dialector Dialector) tableDataTypeOf(field *schema.Field, strict bool) string {
+	dataType := dialector.dataTypeOf(field, strict)
+	if generated, _ := generatedColumn(field); generated != "" {
+		dataType += " " + generated
+	}
+	return dataType
+}
+
+func (dialector Dialector) dataTypeOf(field *schema.Field, strict bool) string {
 	switch field.DataType {
 	case schema.Bool:
-		return "string"
+		if dialector.BoolCheck {
+			return fmt.Sprintf("integer CHECK (`%s` IN (0, 1))", field.DBName)
+		}
+		return "integer"
 	case schema.Int, schema.Uint:
 		if field.AutoIncrement && !field.PrimaryKey {
 			// https://www.sqlite.org/autoinc.html
@@ -68,11 +305,19 @@ func (dialector Dialector) DataTypeOf(field *schema.Field) string {
 	case schema.String:
 		return "text"
 	case schema.Time:
+		if strict {
+			return "text"
+		}
 		return "datetime"
 	case schema.Bytes:
 		return "blob"
+	case "json":
+		return "text"
 	}
 
+	if strict {
+		return strictType(string(field.DataType))
+	}
 	return string(field.DataType)
 }
 
@@ -105,11 +350,27 @@ func (dialector Dialector) QuoteTo(writer clause.Writer, str string) {
 	}
 }
 
+// Explain inlines the vars into the sql, it renders the SQL logged by gorm
+// and the defaults declared by the migrator.
 func (dialector Dialector) Explain(sql string, vars ...interface{}) string {
-	var explainSql = logger.ExplainSQL(sql, nil, `"`, vars...)
+	var explainSql = logger.ExplainSQL(sql, nil, `'`, vars...)
 	dialector.log.Info(dialector.ctx,
 		"call Explain, sql=`%s`,vars=%+v,explainSql=`%s`",
 		sql, vars, explainSql,
 	)
-	return "EXPLAIN " + explainSql
+	return explainSql
+}
+
+var _ gorm.SavePointerDialectorInterface = (*Dialector)(nil)
+
+// SavePoint is emulated by the driver on the statements buffered by a
+// transaction when TransactionMode is d1.TransactionBatch, otherwise it's
+// a no-op and nested transactions are flat.
+func (dialector Dialector) SavePoint(tx *gorm.DB, name string) error {
+	return tx.Exec("SAVEPOINT " + name).Error
+}
+
+// RollbackTo discards the statements buffered since the savepoint.
+func (dialector Dialector) RollbackTo(tx *gorm.DB, name string) error {
+	return tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error
 }
@@ -1,11 +1,15 @@
 package gormd1
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
-	"regexp"
+	"reflect"
+	"strconv"
 	"strings"
 
+	d1 "github.com/kofj/gorm-driver-d1"
+
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"gorm.io/gorm/migrator"
@@ -13,7 +17,16 @@ import (
 )
 
 var (
+	// Deprecated: constraints are implemented, foreign keys are checked at
+	// the end of the batch rebuilding a table.
 	ErrConstraintsNotImplemented = errors.New("constraints not implemented on d1, consider using DisableForeignKeyConstraintWhenMigrating")
+	// ErrReferencedTable is returned rebuilding a table referenced by
+	// foreign keys with ON DELETE actions, dropping it would run them on
+	// the rows referencing it, deferred foreign keys or not.
+	ErrReferencedTable = errors.New("table referenced by foreign keys with ON DELETE actions")
+	// ErrColumnInUse is returned rebuilding a table without columns which
+	// views or triggers mention, unless Config.DropDependents is set.
+	ErrColumnInUse = errors.New("column used by views or triggers")
 )
 
 type Migrator struct {
@@ -30,14 +43,12 @@ func (dialector *Dialector) Migrator(db *gorm.DB) gorm.Migrator {
 	}}}
 }
 
+// RunWithoutForeignKey runs fc.
+//
+// Deprecated: D1 doesn't allow turning foreign keys off, the migrator
+// defers their checks to the end of the batches changing tables with
+// PRAGMA defer_foreign_keys instead.
 func (m *Migrator) RunWithoutForeignKey(fc func() error) error {
-	var enabled int
-	m.DB.Raw("PRAGMA foreign_keys").Scan(&enabled)
-	if enabled == 1 {
-		m.DB.Exec("PRAGMA foreign_keys = OFF")
-		defer m.DB.Exec("PRAGMA foreign_keys = ON")
-	}
-
 	return fc()
 }
 
@@ -49,22 +60,23 @@ func (m Migrator) HasTable(value interface{}) bool {
 	return count > 0
 }
 
+// DropTable drops the tables in one batch, checking foreign keys once
+// all of them are dropped.
 func (m Migrator) DropTable(values ...interface{}) error {
-	return m.RunWithoutForeignKey(func() error {
-		values = m.ReorderModels(values, false)
-		tx := m.DB.Session(&gorm.Session{})
-
-		for i := len(values) - 1; i >= 0; i-- {
-			if err := m.RunWithValue(values[i], func(stmt *gorm.Statement) error {
-				return tx.Exec("DROP TABLE IF EXISTS ?", clause.Table{Name: stmt.Table}).Error
-			}); err != nil {
+	values = m.ReorderModels(values, false)
+	stmts := []string{deferForeignKeys}
+	for i := len(values) - 1; i >= 0; i-- {
+		if err := m.RunWithValue(values[i], func(stmt *gorm.Statement) error {
+			if err := m.destructive("drop table", stmt.Table); err != nil {
 				return err
 			}
+			stmts = append(stmts, fmt.Sprintf("DROP TABLE IF EXISTS %s", quoteIdent(stmt.Table)))
+			return nil
+		}); err != nil {
+			return err
 		}
-
-		return nil
-	})
-
+	}
+	return m.execBatch(stmts)
 }
 
 func (m Migrator) HasColumn(value interface{}, name string) bool {
@@ -85,104 +97,611 @@ func (m Migrator) HasColumn(value interface{}, name string) bool {
 	return count > 0
 }
 
-func (m Migrator) AlterColumn(value interface{}, name string) error {
-	return m.RunWithoutForeignKey(func() error {
-		return m.RunWithValue(value, func(stmt *gorm.Statement) error {
-			if field := stmt.Schema.LookUpField(name); field != nil {
-				var (
-					createSQL    string
-					newTableName = stmt.Table + "__temp"
-				)
-
-				m.DB.Raw("SELECT sql FROM sqlite_master WHERE type = ? AND tbl_name = ? AND name = ?", "table", stmt.Table, stmt.Table).Row().Scan(&createSQL)
+// CreateTable creates the tables with the options declared by models
+// implementing TableOptioner.
+func (m Migrator) CreateTable(values ...interface{}) error {
+	for _, value := range values {
+		tx := m.DB
+		if _, ok := m.DB.Get("gorm:table_options"); !ok {
+			if options := tableOptions(value); options != "" {
+				tx = m.DB.Set("gorm:table_options", " "+options)
+			}
+		}
+		if err := tx.Migrator().(Migrator).Migrator.CreateTable(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-				if reg, err := regexp.Compile("(`|'|\"| )" + field.DBName + "(`|'|\"| ) .*?,"); err == nil {
-					tableReg, err := regexp.Compile(" ('|`|\"| )" + stmt.Table + "('|`|\"| ) ")
-					if err != nil {
-						return err
-					}
+// DataTypeOf returns the declared type of the field, the table is STRICT
+// when the options CreateTable uses, gorm:table_options included, say so.
+func (m Migrator) DataTypeOf(field *schema.Field) string {
+	strict := m.strictTable(field.Schema)
+	if dataTyper, ok := reflect.New(field.IndirectFieldType).Interface().(migrator.GormDataTypeInterface); ok {
+		if dataType := dataTyper.GormDBDataType(m.DB, field); dataType != "" {
+			if strict {
+				return strictType(dataType)
+			}
+			return dataType
+		}
+	}
+	if dialector, ok := m.Dialector.(*Dialector); ok {
+		return dialector.tableDataTypeOf(field, strict)
+	}
+	return m.Migrator.DataTypeOf(field)
+}
 
-					createSQL = tableReg.ReplaceAllString(createSQL, fmt.Sprintf(" `%v` ", newTableName))
-					createSQL = reg.ReplaceAllString(createSQL, fmt.Sprintf("`%v` ?,", field.DBName))
+// FullDataTypeOf is the one of gorm with the type given by DataTypeOf.
+func (m Migrator) FullDataTypeOf(field *schema.Field) clause.Expr {
+	expr := m.Migrator.FullDataTypeOf(field)
+	expr.SQL = m.DataTypeOf(field) + strings.TrimPrefix(expr.SQL, m.Migrator.DataTypeOf(field))
+	return expr
+}
 
-					var columns []string
-					columnTypes, _ := m.DB.Migrator().ColumnTypes(value)
-					for _, columnType := range columnTypes {
-						columns = append(columns, fmt.Sprintf("`%v`", columnType.Name()))
-					}
+// strictTable tells whether the table of the schema is STRICT, as
+// declared by gorm:table_options or else by the model.
+func (m Migrator) strictTable(s *schema.Schema) bool {
+	if options, ok := m.DB.Get("gorm:table_options"); ok {
+		if options, ok := options.(string); ok {
+			return strictOptions(options)
+		}
+	}
+	return strictSchema(s)
+}
 
-					return m.DB.Transaction(func(tx *gorm.DB) error {
-						queries := []string{
-							createSQL,
-							fmt.Sprintf("INSERT INTO `%v`(%v) SELECT %v FROM `%v`", newTableName, strings.Join(columns, ","), strings.Join(columns, ","), stmt.Table),
-							fmt.Sprintf("DROP TABLE `%v`", stmt.Table),
-							fmt.Sprintf("ALTER TABLE `%v` RENAME TO `%v`", newTableName, stmt.Table),
-						}
-						for _, query := range queries {
-							if err := tx.Exec(query, m.FullDataTypeOf(field)).Error; err != nil {
-								return err
-							}
-						}
-						return nil
-					})
-				} else {
-					return err
-				}
-			} else {
-				return fmt.Errorf("failed to alter field with name %v", name)
+// AddColumn adds the column with ALTER TABLE, SQLite can't add STORED
+// generated columns that way so the table is rebuilt with them instead.
+func (m Migrator) AddColumn(value interface{}, name string) error {
+	var stored bool
+	if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		if stmt.Schema != nil {
+			if field := stmt.Schema.LookUpField(name); field != nil {
+				_, stored = generatedColumn(field)
 			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if stored {
+		return m.recreateTable(value, nil, func(ddl *ddl, stmt *gorm.Statement) (*ddl, []interface{}, error) {
+			field := stmt.Schema.LookUpField(name)
+			added, err := m.columnDDL(field)
+			if err != nil {
+				return nil, nil, err
+			}
+			added.sql = quoteIdent(field.DBName) + " ?"
+			ddl.columns = append(ddl.columns, added)
+			return ddl, []interface{}{m.FullDataTypeOf(field)}, nil
 		})
+	}
+
+	if err := m.Migrator.AddColumn(value, name); err != nil || m.recorder() == nil {
+		return err
+	}
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		added, err := m.columnDDL(stmt.Schema.LookUpField(name))
+		if err != nil {
+			return err
+		}
+		return m.recordDDL(stmt.Table, func(table *ddl) error {
+			table.columns = append(table.columns, added)
+			return nil
+		})
+	})
+}
+
+// columnDDL parses the column definition FullDataTypeOf gives the field.
+func (m Migrator) columnDDL(field *schema.Field) (ddlColumn, error) {
+	definition := m.DB.Session(&gorm.Session{DryRun: true}).Exec(
+		"CREATE TABLE t (? ?)", clause.Column{Name: field.DBName}, m.FullDataTypeOf(field),
+	).Statement.SQL.String()
+	parsed, err := parseDDL(definition)
+	if err != nil {
+		return ddlColumn{}, err
+	}
+	return parsed.columns[0], nil
+}
+
+func (m Migrator) AlterColumn(value interface{}, name string) error {
+	return m.recreateTable(value, nil, func(ddl *ddl, stmt *gorm.Statement) (*ddl, []interface{}, error) {
+		field := stmt.Schema.LookUpField(name)
+		if field == nil {
+			return nil, nil, fmt.Errorf("failed to alter field with name %v", name)
+		}
+		columnArg, constraintArgs, err := m.alterColumn(ddl, stmt, field)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ddl, append([]interface{}{columnArg}, constraintArgs...), nil
 	})
 }
 
+// alterColumn declares the column of field in ddl the way the model does,
+// it returns the arg of the column definition and the args of a table
+// constraint added along.
+func (m Migrator) alterColumn(ddl *ddl, stmt *gorm.Statement, field *schema.Field) (interface{}, []interface{}, error) {
+	column := ddl.column(field.DBName)
+	if column == nil {
+		return nil, nil, fmt.Errorf("failed to look up column %v of table %v", field.DBName, stmt.Table)
+	}
+
+	var constraintArgs []interface{}
+	// tables created by earlier versions declare UNIQUE on the column,
+	// which FullDataTypeOf leaves out, keep it as a table constraint
+	if column.constraint(constraintUnique) != nil {
+		uniName := m.DB.NamingStrategy.UniqueName(stmt.Table, field.DBName)
+		if uni, _ := m.GuessConstraintInterfaceAndTable(stmt, uniName); uni != nil {
+			uniSQL, uniArgs := uni.Build()
+			ddl.addConstraint(uniName, uniSQL)
+			constraintArgs = append(constraintArgs, uniArgs...)
+		}
+	}
+	// generated columns aren't copied, keep the parsed column in line
+	altered, err := m.columnDDL(field)
+	if err != nil {
+		return nil, nil, err
+	}
+	column.dataType, column.constraints = altered.dataType, altered.constraints
+	column.sql = quoteIdent(field.DBName) + " ?"
+	return m.FullDataTypeOf(field), constraintArgs, nil
+}
+
+// DropColumn drops the column with ALTER TABLE when SQLite allows it,
+// otherwise the table is rebuilt without the column.
 func (m Migrator) DropColumn(value interface{}, name string) error {
 	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
-		if field := stmt.Schema.LookUpField(name); field != nil {
-			name = field.DBName
+		if stmt.Schema != nil {
+			if field := stmt.Schema.LookUpField(name); field != nil {
+				name = field.DBName
+			}
 		}
 
-		var (
-			createSQL    string
-			newTableName = stmt.Table + "__temp"
-		)
+		rawDDL, err := m.getRawDDL(stmt.Table)
+		if err != nil {
+			return err
+		}
+		parsed, err := parseDDL(rawDDL)
+		if err != nil {
+			return err
+		}
+		if parsed.column(name) == nil {
+			return fmt.Errorf("failed to look up column %v of table %v", name, stmt.Table)
+		}
 
-		m.DB.Raw("SELECT sql FROM sqlite_master WHERE type = ? AND tbl_name = ? AND name = ?", "table", stmt.Table, stmt.Table).Row().Scan(&createSQL)
+		var dependents []string
+		if err := m.DB.Raw(
+			"SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND (type IN ('trigger', 'view') OR (type = 'index' AND tbl_name = ?))", stmt.Table,
+		).Scan(&dependents).Error; err != nil {
+			return err
+		}
 
-		if reg, err := regexp.Compile("(`|'|\"| )" + name + "(`|'|\"| ) .*?,"); err == nil {
-			tableReg, err := regexp.Compile(" ('|`|\"| )" + stmt.Table + "('|`|\"| ) ")
-			if err != nil {
+		if canDropColumn(parsed, name, dependents) {
+			if err := m.destructive("drop column", stmt.Table); err != nil {
+				return err
+			}
+			if err := m.DB.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: stmt.Table}, clause.Column{Name: name}).Error; err != nil {
 				return err
 			}
+			return m.recordDDL(stmt.Table, func(table *ddl) error {
+				table.removeColumn(name)
+				return nil
+			})
+		}
+
+		return m.recreateTable(value, nil, func(ddl *ddl, stmt *gorm.Statement) (*ddl, []interface{}, error) {
+			ddl.removeColumn(name)
+			return ddl, nil, nil
+		})
+	})
+}
 
-			createSQL = tableReg.ReplaceAllString(createSQL, fmt.Sprintf(" `%v` ", newTableName))
-			createSQL = reg.ReplaceAllString(createSQL, "")
+// mentionsDroppedColumn tells whether the sql names a column of origin
+// which the rebuilt table lacks.
+func mentionsDroppedColumn(sql string, origin, rebuilt *ddl) bool {
+	for _, column := range origin.columns {
+		if rebuilt.column(column.name) == nil && mentionsColumn(sql, column.name) {
+			return true
+		}
+	}
+	return false
+}
 
-			var columns []string
-			columnTypes, _ := m.DB.Migrator().ColumnTypes(value)
-			for _, columnType := range columnTypes {
-				if columnType.Name() != name {
-					columns = append(columns, fmt.Sprintf("`%v`", columnType.Name()))
+// canDropColumn tells whether ALTER TABLE DROP COLUMN succeeds, which
+// fails for columns that are part of a key, referenced by constraints of
+// the table or other columns, or used by indexes, triggers and views
+// (the dependents), see https://www.sqlite.org/lang_altertable.html#altertabdropcol
+func canDropColumn(table *ddl, name string, dependents []string) bool {
+	for _, column := range table.columns {
+		for _, constraint := range column.constraints {
+			if strings.EqualFold(column.name, name) {
+				switch constraint.kind {
+				case constraintPrimaryKey, constraintUnique, constraintForeignKey:
+					return false
 				}
+			} else if mentionsColumn(constraint.sql, name) {
+				return false
+			}
+		}
+	}
+	for _, constraint := range table.constraints {
+		if mentionsColumn(constraint.sql, name) {
+			return false
+		}
+	}
+	for _, sql := range dependents {
+		if mentionsColumn(sql, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// mentionsColumn tells whether the sql names the column, it errs on the
+// side of mentioning.
+func mentionsColumn(sql string, name string) bool {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return true
+	}
+	for _, t := range tokens {
+		if (t.kind == tokenWord || t.kind == tokenQuoted) && strings.EqualFold(t.name(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertBoolColumns converts bool columns stored as TEXT "true"/"false",
+// as declared by earlier versions of the dialector, into INTEGER 0/1. The
+// columns of a table declared with another type are altered in one
+// rebuild subject to the destructive policy, which converts their rows
+// while copying them. The rows of columns already declared INTEGER are
+// converted in place by one statement.
+func (m Migrator) ConvertBoolColumns(values ...interface{}) error {
+	for _, value := range values {
+		if !m.HasTable(value) {
+			continue
+		}
+
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			rawDDL, err := m.getRawDDL(stmt.Table)
+			if err != nil {
+				return err
+			}
+			parsed, err := parseDDL(rawDDL)
+			if err != nil {
+				return err
+			}
+			declared := map[string]string{}
+			for _, column := range parsed.columns {
+				declared[column.name] = strings.ToLower(column.dataType)
 			}
 
-			return m.DB.Transaction(func(tx *gorm.DB) error {
-				queries := []string{
-					createSQL,
-					fmt.Sprintf("INSERT INTO `%v`(%v) SELECT %v FROM `%v`", newTableName, strings.Join(columns, ","), strings.Join(columns, ","), stmt.Table),
-					fmt.Sprintf("DROP TABLE `%v`", stmt.Table),
-					fmt.Sprintf("ALTER TABLE `%v` RENAME TO `%v`", newTableName, stmt.Table),
+			var fields []*schema.Field
+			altered := map[string]*schema.Field{}
+			for _, field := range stmt.Schema.Fields {
+				dataType, ok := declared[field.DBName]
+				if field.DataType != schema.Bool || !ok {
+					continue
 				}
-				for _, query := range queries {
-					if err := tx.Exec(query).Error; err != nil {
-						return err
+				fields = append(fields, field)
+				if dataType != "integer" {
+					altered[field.DBName] = field
+				}
+			}
+			if len(fields) == 0 {
+				return nil
+			}
+
+			if len(altered) > 0 {
+				if err := m.recreateTable(value, nil, func(ddl *ddl, stmt *gorm.Statement) (*ddl, []interface{}, error) {
+					var columnArgs, constraintArgs []interface{}
+					ddl.copies = map[string]string{}
+					for _, column := range ddl.columns {
+						field, ok := altered[column.name]
+						if !ok {
+							continue
+						}
+						columnArg, args, err := m.alterColumn(ddl, stmt, field)
+						if err != nil {
+							return nil, nil, err
+						}
+						columnArgs = append(columnArgs, columnArg)
+						constraintArgs = append(constraintArgs, args...)
+						// converted while copied, the new column may not
+						// accept text, e.g. with BoolCheck or STRICT
+						ddl.copies[column.name] = boolCaseSQL(quoteIdent(column.name))
 					}
+					return ddl, append(columnArgs, constraintArgs...), nil
+				}); err != nil {
+					return err
 				}
+			}
+
+			// the rows of the integer columns are converted in place
+			var (
+				sets, conditions []string
+				args             = []interface{}{clause.Table{Name: stmt.Table}}
+				converted        []*schema.Field
+			)
+			for _, field := range fields {
+				if _, ok := altered[field.DBName]; ok {
+					continue
+				}
+				converted = append(converted, field)
+				sets = append(sets, "? = "+boolCaseSQL("?"))
+				column := clause.Column{Name: field.DBName}
+				args = append(args, column, column, column)
+				conditions = append(conditions, "typeof(?) = 'text'")
+			}
+			if len(converted) == 0 {
 				return nil
-			})
-		} else {
+			}
+			for _, field := range converted {
+				args = append(args, clause.Column{Name: field.DBName})
+			}
+			return m.DB.Exec(
+				"UPDATE ? SET "+strings.Join(sets, ", ")+" WHERE "+strings.Join(conditions, " OR "),
+				args...,
+			).Error
+		}); err != nil {
 			return err
 		}
+	}
+	return nil
+}
+
+// boolCaseSQL converts the "true"/"false" text of the column into 1/0,
+// keeping other values.
+func boolCaseSQL(column string) string {
+	return fmt.Sprintf("CASE lower(%s) WHEN 'true' THEN 1 WHEN 'false' THEN 0 ELSE %s END", column, column)
+}
+
+// GetTables returns the tables of the database, leaving out the internal
+// tables of SQLite and D1.
+func (m Migrator) GetTables() (tableList []string, err error) {
+	rows, err := m.DB.Raw("PRAGMA table_list").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			schemaName, name, tableType string
+			ncol, wr, strict            int
+		)
+		if err := rows.Scan(&schemaName, &name, &tableType, &ncol, &wr, &strict); err != nil {
+			return nil, err
+		}
+		if schemaName != "main" || tableType != "table" || isInternalTable(name) {
+			continue
+		}
+		tableList = append(tableList, name)
+	}
+	return tableList, rows.Err()
+}
+
+func isInternalTable(name string) bool {
+	return strings.HasPrefix(name, "sqlite_") || strings.HasPrefix(name, "_cf_")
+}
+
+// ColumnTypes returns the columns of the table as declared, read from
+// PRAGMA table_xinfo.
+func (m Migrator) ColumnTypes(value interface{}) ([]gorm.ColumnType, error) {
+	columnTypes := make([]gorm.ColumnType, 0)
+	execErr := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		uniques, err := m.uniqueColumns(stmt.Table)
+		if err != nil {
+			return err
+		}
+		rawDDL, err := m.getRawDDL(stmt.Table)
+		if err != nil {
+			return err
+		}
+		autoIncrement := strings.Contains(strings.ToUpper(rawDDL), "AUTOINCREMENT")
+
+		rows, err := m.DB.Raw("PRAGMA table_xinfo(?)", clause.Table{Name: stmt.Table}).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				cid, notNull, pk, hidden int
+				name, dataType           string
+				defaultValue             sql.NullString
+			)
+			if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk, &hidden); err != nil {
+				return err
+			}
+			if hidden == 1 {
+				// hidden column of a virtual table
+				continue
+			}
+
+			columnType := parseColumnType(dataType)
+			columnType.NameValue = sql.NullString{String: name, Valid: true}
+			columnType.PrimaryKeyValue = sql.NullBool{Bool: pk > 0, Valid: true}
+			columnType.NullableValue = sql.NullBool{Bool: notNull == 0 && pk == 0, Valid: true}
+			columnType.UniqueValue = sql.NullBool{Bool: uniques[name], Valid: true}
+			columnType.AutoIncrementValue = sql.NullBool{
+				Bool:  autoIncrement && pk > 0 && strings.EqualFold(columnType.DataTypeValue.String, "integer"),
+				Valid: true,
+			}
+			if defaultValue.Valid && !strings.EqualFold(defaultValue.String, "null") {
+				columnType.DefaultValueValue = sql.NullString{String: unquoteDefault(defaultValue.String), Valid: true}
+			}
+			columnTypes = append(columnTypes, columnType)
+		}
+		return rows.Err()
 	})
+	return columnTypes, execErr
+}
+
+// parseColumnType splits a declared type like `varchar(20)` or
+// `decimal(10,2)` into its name and sizes, the scan type follows the
+// affinity of the type, see https://www.sqlite.org/datatype3.html
+func parseColumnType(declared string) migrator.ColumnType {
+	var (
+		dataType         = strings.TrimSpace(declared)
+		length           int64
+		precision, scale int64
+	)
+	if open := strings.IndexByte(dataType, '('); open > 0 && strings.HasSuffix(dataType, ")") {
+		sizes := strings.Split(dataType[open+1:len(dataType)-1], ",")
+		dataType = strings.TrimSpace(dataType[:open])
+		switch len(sizes) {
+		case 1:
+			length, _ = strconv.ParseInt(strings.TrimSpace(sizes[0]), 10, 64)
+		case 2:
+			precision, _ = strconv.ParseInt(strings.TrimSpace(sizes[0]), 10, 64)
+			scale, _ = strconv.ParseInt(strings.TrimSpace(sizes[1]), 10, 64)
+		}
+	}
+
+	var scanType reflect.Type
+	switch affinityOf(dataType) {
+	case "integer":
+		scanType = reflect.TypeOf(int64(0))
+	case "text":
+		scanType = reflect.TypeOf("")
+	case "blob":
+		scanType = reflect.TypeOf([]byte(nil))
+	case "real":
+		scanType = reflect.TypeOf(float64(0))
+	default:
+		scanType = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+
+	return migrator.ColumnType{
+		DataTypeValue:    sql.NullString{String: dataType, Valid: true},
+		ColumnTypeValue:  sql.NullString{String: strings.TrimSpace(declared), Valid: true},
+		LengthValue:      sql.NullInt64{Int64: length, Valid: true},
+		DecimalSizeValue: sql.NullInt64{Int64: precision, Valid: true},
+		ScaleValue:       sql.NullInt64{Int64: scale, Valid: true},
+		ScanTypeValue:    scanType,
+	}
+}
+
+// unquoteDefault strips the quotes SQLite keeps in dflt_value, e.g.
+// `'open'` becomes `open`.
+func unquoteDefault(value string) string {
+	if len(value) >= 2 {
+		if first, last := value[0], value[len(value)-1]; first == last && (first == '\'' || first == '"') {
+			quote := string(first)
+			return strings.ReplaceAll(value[1:len(value)-1], quote+quote, quote)
+		}
+	}
+	return value
+}
+
+// uniqueColumns returns the columns declared UNIQUE on their own, unique
+// indexes created separately are not reported as gorm expects.
+func (m Migrator) uniqueColumns(table string) (map[string]bool, error) {
+	indexes, err := m.indexList(table)
+	if err != nil {
+		return nil, err
+	}
+	uniques := map[string]bool{}
+	for _, index := range indexes {
+		if index.origin != "u" {
+			continue
+		}
+		columns, err := m.indexColumns(index.name)
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) == 1 {
+			uniques[columns[0]] = true
+		}
+	}
+	return uniques, nil
+}
+
+// GetIndexes returns the indexes of the table, read from PRAGMA
+// index_list and index_xinfo.
+func (m Migrator) GetIndexes(value interface{}) ([]gorm.Index, error) {
+	indexes := make([]gorm.Index, 0)
+	err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		list, err := m.indexList(stmt.Table)
+		if err != nil {
+			return err
+		}
+		for _, index := range list {
+			columns, err := m.indexColumns(index.name)
+			if err != nil {
+				return err
+			}
+			indexes = append(indexes, &migrator.Index{
+				TableName:       stmt.Table,
+				NameValue:       index.name,
+				ColumnList:      columns,
+				PrimaryKeyValue: sql.NullBool{Bool: index.origin == "pk", Valid: true},
+				UniqueValue:     sql.NullBool{Bool: index.unique, Valid: true},
+			})
+		}
+		return nil
+	})
+	return indexes, err
+}
+
+type indexInfo struct {
+	name   string
+	unique bool
+	// origin is `c` for CREATE INDEX, `u` for UNIQUE and `pk` for
+	// PRIMARY KEY constraints.
+	origin string
+}
+
+func (m Migrator) indexList(table string) ([]indexInfo, error) {
+	rows, err := m.DB.Raw("PRAGMA index_list(?)", clause.Table{Name: table}).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []indexInfo
+	for rows.Next() {
+		var (
+			seq, unique, partial int
+			index                indexInfo
+		)
+		if err := rows.Scan(&seq, &index.name, &unique, &index.origin, &partial); err != nil {
+			return nil, err
+		}
+		index.unique = unique == 1
+		indexes = append(indexes, index)
+	}
+	return indexes, rows.Err()
+}
+
+// indexColumns returns the key columns of the index, expressions are
+// left out.
+func (m Migrator) indexColumns(index string) ([]string, error) {
+	rows, err := m.DB.Raw("PRAGMA index_xinfo(?)", clause.Table{Name: index}).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var (
+			seqno, cid, desc, key int
+			name, coll            sql.NullString
+		)
+		if err := rows.Scan(&seqno, &cid, &name, &desc, &coll, &key); err != nil {
+			return nil, err
+		}
+		if key == 1 && name.Valid {
+			columns = append(columns, name.String)
+		}
+	}
+	return columns, rows.Err()
 }
 
 func (m Migrator) CreateConstraint(value interface{}, name string) error {
@@ -226,22 +745,26 @@ func (m Migrator) DropConstraint(value interface{}, name string) error {
 }
 
 func (m Migrator) HasConstraint(value interface{}, name string) bool {
-	var count int64
+	var found bool
 	m.RunWithValue(value, func(stmt *gorm.Statement) error {
 		constraint, table := m.GuessConstraintInterfaceAndTable(stmt, name)
 		if constraint != nil {
 			name = constraint.GetName()
 		}
 
-		m.DB.Raw(
-			"SELECT count(*) FROM sqlite_master WHERE type = ? AND tbl_name = ? AND (sql LIKE ? OR sql LIKE ? OR sql LIKE ? OR sql LIKE ? OR sql LIKE ?)",
-			"table", table, `%CONSTRAINT "`+name+`" %`, `%CONSTRAINT `+name+` %`, "%CONSTRAINT `"+name+"`%", "%CONSTRAINT ["+name+"]%", "%CONSTRAINT \t"+name+"\t%",
-		).Row().Scan(&count)
-
+		rawDDL, err := m.getRawDDL(table)
+		if err != nil || rawDDL == "" {
+			return err
+		}
+		parsed, err := parseDDL(rawDDL)
+		if err != nil {
+			return err
+		}
+		found = parsed.hasConstraint(name)
 		return nil
 	})
 
-	return count > 0
+	return found
 }
 
 func (m Migrator) CurrentDatabase() (name string) {
@@ -340,6 +863,12 @@ func (m Migrator) DropIndex(value interface{}, name string) error {
 }
 
 func (m Migrator) getRawDDL(table string) (string, error) {
+	if rec := m.recorder(); rec != nil {
+		if createSQL, ok := rec.tables[table]; ok {
+			return createSQL, nil
+		}
+	}
+
 	var createSQL string
 	m.DB.Raw("SELECT sql FROM sqlite_master WHERE type = ? AND tbl_name = ? AND name = ?", "table", table, table).Row().Scan(&createSQL)
 
@@ -376,31 +905,91 @@ func (m Migrator) recreateTable(
 		if createDDL == nil {
 			return nil
 		}
+		if err := m.checkReferences(table); err != nil {
+			return err
+		}
+		// indexes and triggers go along with the table, views and triggers
+		// referring to it are dropped first, recreate the ones still
+		// applying to its columns
+		dependents, err := m.dependents(table)
+		if err != nil {
+			return err
+		}
+		var dropped []string
+		for _, dependent := range dependents {
+			if dependent.kind != "index" && mentionsDroppedColumn(dependent.sql, originDDL, createDDL) {
+				dropped = append(dropped, dependent.kind+" "+dependent.name)
+			}
+		}
+		if len(dropped) > 0 && !m.config().DropDependents {
+			return fmt.Errorf("%w: rebuilding %s drops columns mentioned by %s, drop them first or set DropDependents",
+				ErrColumnInUse, table, strings.Join(dropped, ", "))
+		}
+		if err := m.destructive("rebuild table", table); err != nil {
+			return err
+		}
 
 		newTableName := table + "__temp"
 		if err := createDDL.renameTable(newTableName, table); err != nil {
 			return err
 		}
+		createSQL := m.DB.Session(&gorm.Session{DryRun: true}).Exec(createDDL.compile(), sqlArgs...).Statement.SQL.String()
 
-		columns := createDDL.getColumns()
-		createSQL := createDDL.compile()
-
-		return m.DB.Transaction(func(tx *gorm.DB) error {
-			if err := tx.Exec(createSQL, sqlArgs...).Error; err != nil {
+		// a __temp table left by an interrupted rebuild is resumed, unless
+		// it was created for another change, its rows have no rowid to
+		// resume from or the rebuild is recorded
+		tempSQL, err := m.getRawDDL(newTableName)
+		if err != nil {
+			return err
+		}
+		rec := m.recorder()
+		_, _, key := copyColumns(originDDL, createDDL)
+		if tempSQL != createSQL || key == "" || rec != nil {
+			if tempSQL != "" {
+				if err := m.DB.Exec("DROP TABLE ?", clause.Table{Name: newTableName}).Error; err != nil {
+					return err
+				}
+			}
+			if err := m.DB.Exec(createSQL).Error; err != nil {
 				return err
 			}
+		}
+
+		if err := m.copyRows(table, originDDL, createDDL); err != nil {
+			return err
+		}
 
-			queries := []string{
-				fmt.Sprintf("INSERT INTO `%v`(%v) SELECT %v FROM `%v`", newTableName, strings.Join(columns, ","), strings.Join(columns, ","), table),
-				fmt.Sprintf("DROP TABLE `%v`", table),
-				fmt.Sprintf("ALTER TABLE `%v` RENAME TO `%v`", newTableName, table),
+		swap := []string{deferForeignKeys}
+		if catchUp := catchUpSQL(table, originDDL, createDDL); catchUp != "" && rec == nil {
+			swap = append(swap, catchUp)
+		}
+		for _, dependent := range dependents {
+			if !strings.EqualFold(dependent.table, table) {
+				swap = append(swap, fmt.Sprintf("DROP %s IF EXISTS %s", strings.ToUpper(dependent.kind), quoteIdent(dependent.name)))
 			}
-			for _, query := range queries {
-				if err := tx.Exec(query).Error; err != nil {
-					return err
-				}
+		}
+		swap = append(swap,
+			fmt.Sprintf("DROP TABLE %s", quoteIdent(table)),
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdent(newTableName), quoteIdent(table)),
+		)
+		for _, dependent := range dependents {
+			if mentionsDroppedColumn(dependent.sql, originDDL, createDDL) {
+				d1.Trace("rebuilding %s: %s %s dropped along with a column", table, dependent.kind, dependent.name)
+				continue
+			}
+			swap = append(swap, dependent.sql)
+		}
+		if err := m.execBatch(swap); err != nil {
+			return err
+		}
+		if rec != nil {
+			// the rebuilt table only exists in the recorded statements
+			if err := createDDL.renameTable(table, newTableName); err != nil {
+				return err
 			}
+			rec.tables[table] = m.DB.Session(&gorm.Session{DryRun: true}).Exec(createDDL.compile(), sqlArgs...).Statement.SQL.String()
 			return nil
-		})
+		}
+		return m.checkForeignKeys(table)
 	})
 }
@@ -0,0 +1,237 @@
+package gormd1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseColumnType(t *testing.T) {
+	columnType := parseColumnType("varchar(20)")
+	assert.Equal(t, "varchar", columnType.DatabaseTypeName())
+	full, _ := columnType.ColumnType()
+	assert.Equal(t, "varchar(20)", full)
+	length, ok := columnType.Length()
+	assert.True(t, ok)
+	assert.Equal(t, int64(20), length)
+	assert.Equal(t, reflect.TypeOf(""), columnType.ScanType())
+
+	columnType = parseColumnType("DECIMAL(10, 2)")
+	assert.Equal(t, "DECIMAL", columnType.DatabaseTypeName())
+	precision, scale, ok := columnType.DecimalSize()
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), precision)
+	assert.Equal(t, int64(2), scale)
+
+	assert.Equal(t, reflect.TypeOf(int64(0)), parseColumnType("integer").ScanType())
+	assert.Equal(t, reflect.TypeOf(float64(0)), parseColumnType("real").ScanType())
+	assert.Equal(t, reflect.TypeOf([]byte(nil)), parseColumnType("").ScanType())
+}
+
+func TestUnquoteDefault(t *testing.T) {
+	assert.Equal(t, "open", unquoteDefault("'open'"))
+	assert.Equal(t, "it's", unquoteDefault("'it''s'"))
+	assert.Equal(t, "open", unquoteDefault(`"open"`))
+	assert.Equal(t, "0", unquoteDefault("0"))
+	assert.Equal(t, "CURRENT_TIMESTAMP", unquoteDefault("CURRENT_TIMESTAMP"))
+}
+
+func TestCanDropColumn(t *testing.T) {
+	parsed, err := parseDDL("CREATE TABLE `orders` (`id` integer PRIMARY KEY AUTOINCREMENT, `code` text UNIQUE, `user_id` integer REFERENCES `users`(`id`), " +
+		"`amount` integer CHECK (`amount` > 0), `discount` integer, `note` text, `tag` text, `total` integer AS (amount - discount), " +
+		"`shop` text, `region` text, CONSTRAINT `chk_region` CHECK (region <> ''), UNIQUE (`shop`, lower(`tag`)))")
+	if !assert.Nil(t, err) {
+		return
+	}
+	indexes := []string{"CREATE INDEX `idx_orders_note` ON `orders`(`note`)"}
+
+	var tests = map[string]bool{
+		"id":       false, // primary key
+		"code":     false, // unique
+		"user_id":  false, // foreign key
+		"amount":   false, // used by total
+		"discount": false, // used by total
+		"note":     false, // indexed
+		"tag":      false, // in a table constraint
+		"shop":     false,
+		"region":   false,
+		"total":    true,
+	}
+	for column, expected := range tests {
+		assert.Equalf(t, expected, canDropColumn(parsed, column, indexes), column)
+	}
+
+	parsed, err = parseDDL("CREATE TABLE `users` (`id` integer PRIMARY KEY, `name` text, `age` integer CHECK (age >= 0))")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, canDropColumn(parsed, "age", nil), "own check constraint")
+	assert.True(t, canDropColumn(parsed, "name", nil))
+	assert.False(t, canDropColumn(parsed, "name", []string{"CREATE VIEW names AS SELECT name FROM users"}))
+	assert.False(t, canDropColumn(parsed, "name", []string{"CREATE TRIGGER t AFTER UPDATE OF `name` ON users BEGIN SELECT 1; END"}))
+}
+
+func TestOnDeleteOf(t *testing.T) {
+	var tests = []struct {
+		ddl      string
+		expected string
+	}{
+		{"CREATE TABLE `books` (`id` integer, `author_id` integer, CONSTRAINT `fk_authors_books` FOREIGN KEY (`author_id`) REFERENCES `authors`(`id`) ON UPDATE CASCADE ON DELETE CASCADE)", "CASCADE"},
+		{"CREATE TABLE `books` (`id` integer, `author_id` integer REFERENCES authors ON DELETE SET NULL)", "SET NULL"},
+		{"CREATE TABLE `books` (`id` integer, `author_id` integer, FOREIGN KEY (`author_id`) REFERENCES `authors`(`id`) ON DELETE RESTRICT)", "RESTRICT"},
+		{"CREATE TABLE `books` (`id` integer, `author_id` integer, FOREIGN KEY (`author_id`) REFERENCES `authors`(`id`) ON UPDATE CASCADE)", ""},
+		{"CREATE TABLE `books` (`id` integer, `author_id` integer, FOREIGN KEY (`author_id`) REFERENCES `authors`(`id`) ON DELETE NO ACTION)", ""},
+		{"CREATE TABLE `books` (`id` integer, `shelf_id` integer REFERENCES `shelves`(`id`) ON DELETE CASCADE)", ""},
+	}
+	for _, test := range tests {
+		parsed, err := parseDDL(test.ddl)
+		if !assert.Nilf(t, err, test.ddl) {
+			continue
+		}
+		assert.Equalf(t, test.expected, onDeleteOf(parsed, "authors"), test.ddl)
+	}
+}
+
+func TestRowidAlias(t *testing.T) {
+	var tests = map[string]string{
+		"CREATE TABLE `users` (`id` integer PRIMARY KEY AUTOINCREMENT, `name` text)": "id",
+		"CREATE TABLE `members` (`id` integer, `name` text, PRIMARY KEY (`id`))":     "id",
+		"CREATE TABLE `kv` (`key` text PRIMARY KEY, `value` blob)":                   "",
+		"CREATE TABLE `pairs` (`a` integer, `b` integer, PRIMARY KEY (`a`, `b`))":    "",
+		"CREATE TABLE `big` (`id` bigint PRIMARY KEY)":                               "",
+		"CREATE TABLE `kv` (`id` INTEGER PRIMARY KEY, `value` blob) WITHOUT ROWID":   "",
+	}
+	for sql, expected := range tests {
+		parsed, err := parseDDL(sql)
+		if !assert.Nil(t, err) {
+			continue
+		}
+		assert.Equalf(t, expected, rowidAlias(parsed), sql)
+	}
+}
+
+func TestCatchUpSQL(t *testing.T) {
+	var tests = []struct {
+		origin, dst string
+		expected    string
+	}{
+		{
+			"CREATE TABLE `users` (`id` integer PRIMARY KEY AUTOINCREMENT, `name` text, `note` text)",
+			"CREATE TABLE `users__temp` (`id` integer PRIMARY KEY AUTOINCREMENT, `name` text)",
+			"INSERT INTO `users__temp` (`id`,`name`) SELECT `id`,`name` FROM `users` " +
+				"WHERE (SELECT max(`id`) FROM `users__temp`) IS NULL OR `id` > (SELECT max(`id`) FROM `users__temp`)",
+		},
+		{
+			"CREATE TABLE `kv` (`key` text PRIMARY KEY, `value` blob)",
+			"CREATE TABLE `kv__temp` (`key` text PRIMARY KEY, `value` text)",
+			"INSERT INTO `kv__temp` (rowid,`key`,`value`) SELECT rowid,`key`,`value` FROM `kv` " +
+				"WHERE (SELECT max(rowid) FROM `kv__temp`) IS NULL OR rowid > (SELECT max(rowid) FROM `kv__temp`)",
+		},
+		{
+			"CREATE TABLE `kv` (`key` text PRIMARY KEY, `value` blob) WITHOUT ROWID",
+			"CREATE TABLE `kv__temp` (`key` text PRIMARY KEY, `value` text) WITHOUT ROWID",
+			"",
+		},
+	}
+	for _, test := range tests {
+		origin, err := parseDDL(test.origin)
+		if !assert.Nil(t, err) {
+			continue
+		}
+		dst, err := parseDDL(test.dst)
+		if !assert.Nil(t, err) {
+			continue
+		}
+		assert.Equalf(t, test.expected, catchUpSQL(origin.table, origin, dst), test.dst)
+	}
+}
+
+func TestCopyColumns(t *testing.T) {
+	origin, err := parseDDL("CREATE TABLE `flags` (`id` integer PRIMARY KEY, `enabled` text, `total` integer GENERATED ALWAYS AS (id * 2))")
+	if !assert.Nil(t, err) {
+		return
+	}
+	dst, err := parseDDL("CREATE TABLE `flags__temp` (`id` integer PRIMARY KEY, `enabled` integer, `total` integer GENERATED ALWAYS AS (id * 2))")
+	if !assert.Nil(t, err) {
+		return
+	}
+	dst.copies = map[string]string{"enabled": boolCaseSQL("`enabled`")}
+
+	insert, sel, key := copyColumns(origin, dst)
+	assert.Equal(t, "`id`,`enabled`", insert)
+	assert.Equal(t, "`id`,CASE lower(`enabled`) WHEN 'true' THEN 1 WHEN 'false' THEN 0 ELSE `enabled` END", sel)
+	assert.Equal(t, "`id`", key)
+}
+
+func TestMentionsDroppedColumn(t *testing.T) {
+	origin, _ := parseDDL("CREATE TABLE `users` (`id` integer PRIMARY KEY, `name` text, `age` integer)")
+	rebuilt := origin.clone()
+	rebuilt.removeColumn("age")
+
+	assert.True(t, mentionsDroppedColumn("CREATE INDEX `idx_users_age` ON `users`(`age`)", origin, rebuilt))
+	assert.False(t, mentionsDroppedColumn("CREATE INDEX `idx_users_name` ON `users`(`name`)", origin, rebuilt))
+	assert.True(t, mentionsDroppedColumn("CREATE TRIGGER t AFTER INSERT ON users BEGIN UPDATE users SET age = 0 WHERE id = new.id; END", origin, rebuilt))
+}
+
+func TestInlineArgs(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sql, err := inlineArgs(
+		"UPDATE `t` SET a = ?, b = ?, c = ?, d = ?, e = ?, f = ? WHERE g = '?' AND h = ? AND `i?` = ?",
+		[]interface{}{nil, true, int64(-1), 1.5, "it's", []byte{0, 255}, at, uint8(7)},
+		time.RFC3339Nano,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE `t` SET a = NULL, b = 1, c = -1, d = 1.5, e = 'it''s', f = x'00ff' WHERE g = '?' AND h = '2024-01-02T03:04:05Z' AND `i?` = 7", sql)
+
+	sql, err = inlineArgs("SELECT 'a''?', ?", []interface{}{1}, time.RFC3339Nano)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT 'a''?', 1", sql)
+
+	_, err = inlineArgs("SELECT ?, ?", []interface{}{1}, time.RFC3339Nano)
+	assert.NotNil(t, err, "missing args")
+	_, err = inlineArgs("SELECT ?", []interface{}{1, 2}, time.RFC3339Nano)
+	assert.NotNil(t, err, "too many args")
+	_, err = inlineArgs("SELECT ?", []interface{}{struct{}{}}, time.RFC3339Nano)
+	assert.NotNil(t, err, "unsupported arg")
+}
+
+func TestRewrittenTable(t *testing.T) {
+	var tests = map[string]string{
+		"UPDATE `users` SET `active` = 1":                                "users",
+		"UPDATE OR IGNORE users SET a = 1":                               "users",
+		"CREATE INDEX `idx_users_name` ON `users`(`name`)":               "users",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx ON \"order items\" (qty)": "order items",
+		"ALTER TABLE `users` DROP COLUMN `age`":                          "users",
+		"ALTER TABLE `users` ADD `age` integer":                          "",
+		"CREATE TRIGGER t AFTER INSERT ON users BEGIN SELECT 1; END":     "",
+		"CREATE TABLE `users__temp` (`id` integer)":                      "",
+		"INSERT INTO `users__temp` (`id`) SELECT `id` FROM `users`":      "",
+		"PRAGMA defer_foreign_keys = true":                               "",
+	}
+	for sql, expected := range tests {
+		assert.Equalf(t, expected, rewrittenTable(sql), sql)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	plan := Plan{Statements: []PlannedStatement{
+		{SQL: "CREATE TABLE `users__temp` (`id` integer)"},
+		{SQL: "INSERT INTO `users__temp` (`id`) SELECT `id` FROM `users`", Rows: 3},
+		{SQL: "CREATE INDEX `idx` ON `users`(`id`)", Rows: 3},
+	}}
+	assert.Equal(t, int64(6), plan.Rows())
+	assert.Equal(t, "CREATE TABLE `users__temp` (`id` integer);\n"+
+		"-- writes ~3 rows\nINSERT INTO `users__temp` (`id`) SELECT `id` FROM `users`;\n"+
+		"-- writes ~3 rows\nCREATE INDEX `idx` ON `users`(`id`);\n", plan.String())
+}
+
+func TestMentionsName(t *testing.T) {
+	names := map[string]bool{"users": true, "active users": true}
+	assert.True(t, mentionsName("CREATE VIEW v AS SELECT * FROM users", names))
+	assert.True(t, mentionsName("CREATE VIEW v AS SELECT * FROM `Users`", names))
+	assert.True(t, mentionsName(`CREATE VIEW v AS SELECT * FROM "active users"`, names))
+	assert.False(t, mentionsName("CREATE VIEW v AS SELECT 'users' FROM members", names))
+	assert.False(t, mentionsName("CREATE TRIGGER t AFTER INSERT ON members BEGIN SELECT 1; END", names))
+}
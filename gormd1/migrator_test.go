@@ -1,9 +1,14 @@
 package gormd1_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	d1 "github.com/kofj/gorm-driver-d1"
+	"github.com/kofj/gorm-driver-d1/gormd1"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
@@ -57,6 +62,55 @@ func TestMigrator(t *testing.T) {
 		assert.Truef(t, result, "expect %v table exist name field.", &User{})
 	})
 
+	t.Run("ColumnTypes", func(t *testing.T) {
+		columnTypes, err := gdb.Migrator().ColumnTypes(&User{})
+		if !assert.Nilf(t, err, "column types") {
+			return
+		}
+		var columns = map[string]gorm.ColumnType{}
+		for _, columnType := range columnTypes {
+			columns[columnType.Name()] = columnType
+		}
+
+		pk, _ := columns["id"].PrimaryKey()
+		assert.Truef(t, pk, "id is primary key")
+		assert.Equalf(t, "integer", columns["id"].DatabaseTypeName(), "id type")
+		unique, _ := columns["name"].Unique()
+		assert.Truef(t, unique, "name is unique")
+		assert.Equalf(t, "text", columns["name"].DatabaseTypeName(), "name type")
+		nullable, _ := columns["age"].Nullable()
+		assert.Truef(t, nullable, "age is nullable")
+	})
+
+	t.Run("GetIndexes", func(t *testing.T) {
+		indexes, err := gdb.Migrator().GetIndexes(&User{})
+		if !assert.Nilf(t, err, "get indexes") {
+			return
+		}
+		var names []string
+		for _, index := range indexes {
+			names = append(names, index.Name())
+		}
+		assert.Containsf(t, names, "idx_name", "indexes")
+		assert.Containsf(t, names, "idx_users_deleted_at", "indexes")
+	})
+
+	t.Run("GetTables", func(t *testing.T) {
+		tables, err := gdb.Migrator().GetTables()
+		if !assert.Nilf(t, err, "get tables") {
+			return
+		}
+		assert.Containsf(t, tables, "users", "tables")
+		for _, table := range tables {
+			assert.NotRegexpf(t, "^(sqlite_|_cf_)", table, "internal table")
+		}
+	})
+
+	t.Run("AutoMigrate Again", func(t *testing.T) {
+		var err = gdb.AutoMigrate(&User{})
+		assert.Nilf(t, err, "migrate again")
+	})
+
 	t.Run("HasIndex", func(t *testing.T) {
 		migrator := gdb.Migrator()
 		var result = migrator.HasIndex(&User{}, "idx_users_deleted_at")
@@ -147,3 +201,593 @@ func TestMigrator(t *testing.T) {
 	})
 
 }
+
+type LegacyFlag struct {
+	ID      uint
+	Enabled bool
+	Visible bool
+}
+
+func TestConvertBoolColumns(t *testing.T) {
+	var err = gdb.Exec("CREATE TABLE `legacy_flags` (`id` integer PRIMARY KEY, `enabled` string, `visible` string)").Error
+	if !assert.Nilf(t, err, "create table") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&LegacyFlag{})
+	})
+
+	err = gdb.Exec("INSERT INTO `legacy_flags` (`id`, `enabled`, `visible`) VALUES (1, 'true', 'false'), (2, 'false', 'true')").Error
+	if !assert.Nilf(t, err, "insert legacy rows") {
+		return
+	}
+
+	production, err := gorm.Open(gormd1.New(gormd1.Config{DSN: defaultDSN, Production: true}), &gorm.Config{})
+	if !assert.Nilf(t, err, "open") {
+		return
+	}
+	err = production.Migrator().(gormd1.Migrator).ConvertBoolColumns(&LegacyFlag{})
+	assert.ErrorIsf(t, err, gormd1.ErrDestructiveMigration, "rebuild denied")
+	var untouched int64
+	gdb.Model(&LegacyFlag{}).Where("`enabled` = 'true'").Count(&untouched)
+	assert.Equalf(t, int64(1), untouched, "rows left as they were")
+
+	// the rebuilt columns only take 0 and 1, rows are converted while copied
+	checked, err := gorm.Open(gormd1.New(gormd1.Config{DSN: defaultDSN, BoolCheck: true}), &gorm.Config{})
+	if !assert.Nilf(t, err, "open") {
+		return
+	}
+	err = checked.Migrator().(gormd1.Migrator).ConvertBoolColumns(&LegacyFlag{})
+	if !assert.Nilf(t, err, "convert bool columns") {
+		return
+	}
+
+	var count int64
+	gdb.Model(&LegacyFlag{}).Where("`enabled` = 1 AND `visible` = 0").Count(&count)
+	assert.Equalf(t, int64(1), count, "converted rows")
+
+	var flag LegacyFlag
+	gdb.First(&flag, 2)
+	assert.Falsef(t, flag.Enabled, "enabled")
+	assert.Truef(t, flag.Visible, "visible")
+}
+
+type Gadget struct {
+	ID    uint
+	Code  string `gorm:"uniqueIndex"`
+	Color string
+	Size  int
+	Note  string
+}
+
+func TestDropAndRenameColumn(t *testing.T) {
+	if err := gdb.AutoMigrate(&Gadget{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&Gadget{})
+	})
+	if err := gdb.Create(&Gadget{Code: "a", Color: "red", Size: 1, Note: "n"}).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+
+	migrator := gdb.Migrator()
+	// natively
+	assert.Nilf(t, migrator.DropColumn(&Gadget{}, "Note"), "drop column")
+	assert.Falsef(t, migrator.HasColumn(&Gadget{}, "note"), "note dropped")
+	// indexed, rebuilds the table
+	assert.Nilf(t, migrator.DropColumn(&Gadget{}, "code"), "drop indexed column")
+	assert.Falsef(t, migrator.HasColumn(&Gadget{}, "code"), "code dropped")
+
+	assert.Nilf(t, migrator.RenameColumn(&Gadget{}, "color", "colour"), "rename column")
+	assert.Truef(t, migrator.HasColumn(&Gadget{}, "colour"), "colour")
+
+	var colour string
+	gdb.Table("gadgets").Select("colour").Where("size = ?", 1).Row().Scan(&colour)
+	assert.Equalf(t, "red", colour, "data kept")
+}
+
+func TestChunkedRebuild(t *testing.T) {
+	var progress []int64
+	db, err := gorm.Open(gormd1.New(gormd1.Config{
+		DSN:              defaultDSN,
+		RebuildChunkSize: 2,
+		RebuildProgress: func(table string, copied, total int64) {
+			assert.Equal(t, "gadgets", table)
+			assert.Equal(t, int64(5), total)
+			progress = append(progress, copied)
+			if copied == total {
+				// written once every row was copied, caught up by the swap
+				assert.Nilf(t, gdb.Create(&Gadget{Code: "f"}).Error, "concurrent write")
+			}
+		},
+	}), &gorm.Config{SkipDefaultTransaction: true})
+	if !assert.Nilf(t, err, "open") {
+		return
+	}
+
+	if err := db.AutoMigrate(&Gadget{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&Gadget{})
+	})
+	gadgets := []Gadget{{Code: "a"}, {Code: "b"}, {Code: "c"}, {Code: "d"}, {Code: "e"}}
+	if err := db.Create(&gadgets).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+
+	// a __temp table left by another change is replaced
+	err = db.Exec("CREATE TABLE `gadgets__temp` AS SELECT * FROM `gadgets` WHERE 0").Error
+	assert.Nilf(t, err, "stale temp table")
+
+	// indexed, rebuilds the table
+	if err := db.Migrator().DropColumn(&Gadget{}, "code"); !assert.Nilf(t, err, "drop column") {
+		return
+	}
+	assert.Equal(t, []int64{2, 4, 5}, progress)
+	assert.False(t, db.Migrator().HasTable("gadgets__temp"))
+
+	var count int64
+	db.Table("gadgets").Count(&count)
+	assert.Equal(t, int64(6), count)
+}
+
+type Setting struct {
+	Key   string `gorm:"primaryKey"`
+	Value string
+}
+
+func (Setting) TableOptions() string {
+	return "WITHOUT ROWID"
+}
+
+func TestRebuildWithoutRowid(t *testing.T) {
+	if err := gdb.AutoMigrate(&Setting{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&Setting{}, "settings__temp")
+	})
+	if err := gdb.Create([]Setting{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+
+	// an interrupted rebuild left its rows, they can't be resumed without rowid
+	var rawDDL string
+	gdb.Raw("SELECT sql FROM sqlite_master WHERE type = ? AND name = ?", "table", "settings").Row().Scan(&rawDDL)
+	err := gdb.Exec(strings.Replace(rawDDL, "`settings`", "`settings__temp`", 1)).Error
+	assert.Nilf(t, err, "temp table")
+	assert.Nilf(t, gdb.Exec("INSERT INTO `settings__temp` SELECT * FROM `settings`").Error, "copied rows")
+
+	if err := gdb.Migrator().AlterColumn(&Setting{}, "Value"); !assert.Nilf(t, err, "rebuild") {
+		return
+	}
+	var count int64
+	gdb.Model(&Setting{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+type Author struct {
+	ID    uint
+	Name  string
+	Books []Book `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+type Book struct {
+	ID       uint
+	Title    string
+	AuthorID uint
+}
+
+func TestForeignKeys(t *testing.T) {
+	db, err := gorm.Open(gormd1.Open(defaultDSN), &gorm.Config{SkipDefaultTransaction: true})
+	if !assert.Nilf(t, err, "open") {
+		return
+	}
+	if err := db.AutoMigrate(&Author{}, &Book{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&Book{}, &Author{})
+	})
+
+	migrator := db.Migrator()
+	assert.Truef(t, migrator.HasConstraint(&Author{}, "Books"), "created with the table")
+
+	author := Author{Name: "kofj", Books: []Book{{Title: "a"}, {Title: "b"}}}
+	if err := db.Create(&author).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+	err = db.Create(&Book{Title: "orphan", AuthorID: author.ID + 100}).Error
+	assert.ErrorIsf(t, db.Dialector.(*gormd1.Dialector).Translate(err), gorm.ErrForeignKeyViolated, "orphan")
+
+	// dropping the parent would cascade to the books
+	err = migrator.AlterColumn(&Author{}, "Name")
+	assert.ErrorIsf(t, err, gormd1.ErrReferencedTable, "alter parent")
+	var books int64
+	db.Model(&Book{}).Count(&books)
+	assert.Equalf(t, int64(2), books, "books kept")
+
+	assert.Nilf(t, migrator.DropConstraint(&Author{}, "Books"), "drop constraint")
+	assert.Falsef(t, migrator.HasConstraint(&Author{}, "Books"), "dropped")
+	assert.Nilf(t, migrator.CreateConstraint(&Author{}, "Books"), "create constraint")
+	assert.Truef(t, migrator.HasConstraint(&Author{}, "Books"), "created")
+
+	violations, err := migrator.(gormd1.Migrator).ForeignKeyViolations(&Book{})
+	assert.Nilf(t, err, "foreign key check")
+	assert.Emptyf(t, violations, "violations")
+
+	assert.Nilf(t, db.Delete(&author).Error, "delete author")
+	var count int64
+	db.Model(&Book{}).Count(&count)
+	assert.Equalf(t, int64(0), count, "cascaded")
+}
+
+type Shelf struct {
+	ID    uint
+	Name  string
+	Items []ShelfItem
+}
+
+type ShelfItem struct {
+	ID      uint
+	Label   string
+	ShelfID uint
+}
+
+func TestRebuildReferencedTable(t *testing.T) {
+	db, err := gorm.Open(gormd1.Open(defaultDSN), &gorm.Config{SkipDefaultTransaction: true})
+	if !assert.Nilf(t, err, "open") {
+		return
+	}
+	if err := db.AutoMigrate(&Shelf{}, &ShelfItem{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&ShelfItem{}, &Shelf{})
+	})
+	shelf := Shelf{Name: "a", Items: []ShelfItem{{Label: "x"}, {Label: "y"}}}
+	if err := db.Create(&shelf).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+
+	// without ON DELETE actions, the items are checked at the end of the batch
+	assert.Nilf(t, db.Migrator().AlterColumn(&Shelf{}, "Name"), "alter parent")
+	var items int64
+	db.Model(&ShelfItem{}).Where("shelf_id = ?", shelf.ID).Count(&items)
+	assert.Equalf(t, int64(2), items, "items kept")
+}
+
+type GadgetV2 struct {
+	ID     uint
+	Code   string `gorm:"uniqueIndex"`
+	Color  string
+	Weight float64 `gorm:"index"`
+	Size   string
+	Note   string
+}
+
+func (GadgetV2) TableName() string {
+	return "gadgets"
+}
+
+func TestGenerateMigration(t *testing.T) {
+	if err := gdb.AutoMigrate(&Gadget{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&Gadget{})
+	})
+	migrator := gdb.Migrator().(gormd1.Migrator)
+	dir := t.TempDir()
+
+	file, err := migrator.GenerateMigration(dir, "gadgets", &Gadget{})
+	assert.Nilf(t, err, "up to date")
+	assert.Emptyf(t, file, "no migration")
+
+	// adds weight, then rebuilds the table to alter size
+	file, err = migrator.GenerateMigration(dir, "gadgets v2", &GadgetV2{})
+	if !assert.Nilf(t, err, "generate") {
+		return
+	}
+	assert.Equal(t, filepath.Join(dir, "0001_gadgets_v2.sql"), file)
+	assert.Falsef(t, migrator.HasColumn(&GadgetV2{}, "weight"), "nothing executed")
+
+	content, _ := os.ReadFile(file)
+	assert.Contains(t, string(content), "ALTER TABLE `gadgets` ADD `weight` real;\n")
+	assert.Regexp(t, "CREATE TABLE `gadgets__temp` \\(.*`weight` real.*`size` text", string(content), "rebuilt with the added column")
+	assert.Contains(t, string(content), "PRAGMA defer_foreign_keys = true;\n")
+	assert.Contains(t, string(content), "ALTER TABLE `gadgets__temp` RENAME TO `gadgets`;\n")
+	assert.Contains(t, string(content), "CREATE INDEX `idx_gadgets_weight` ON `gadgets`(`weight`);\n")
+
+	for _, stmt := range d1.SplitStatements(string(content)) {
+		if err := gdb.Exec(stmt).Error; !assert.Nilf(t, err, stmt) {
+			return
+		}
+	}
+	file, err = migrator.GenerateMigration(dir, "gadgets v2", &GadgetV2{})
+	assert.Nilf(t, err, "applied")
+	assert.Emptyf(t, file, "up to date")
+}
+
+func TestPlanAutoMigrate(t *testing.T) {
+	if err := gdb.AutoMigrate(&Gadget{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&Gadget{})
+	})
+	gadgets := []Gadget{{Code: "a", Size: 1}, {Code: "b", Size: 2}, {Code: "c", Size: 3}}
+	if err := gdb.Create(&gadgets).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+
+	migrator := gdb.Migrator().(gormd1.Migrator)
+	plan, err := migrator.PlanAutoMigrate(&GadgetV2{})
+	if !assert.Nilf(t, err, "plan") {
+		return
+	}
+	assert.Falsef(t, migrator.HasColumn(&GadgetV2{}, "weight"), "nothing executed")
+	assert.Equalf(t, "integer", columnType(t, migrator, "size"), "not rebuilt")
+
+	var copied bool
+	for _, stmt := range plan.Statements {
+		if strings.HasPrefix(stmt.SQL, "INSERT INTO `gadgets__temp`") {
+			copied = true
+			assert.Equalf(t, int64(3), stmt.Rows, "rows copied")
+		}
+		if strings.HasPrefix(stmt.SQL, "CREATE UNIQUE INDEX `idx_gadgets_code`") {
+			assert.Equalf(t, int64(3), stmt.Rows, "index recreated")
+		}
+	}
+	assert.Truef(t, copied, "rebuild copy planned")
+	assert.Equal(t, int64(9), plan.Rows(), "copy, recreated index and new index")
+
+	plan, err = migrator.PlanAutoMigrate(&Gadget{})
+	assert.Nilf(t, err, "plan")
+	assert.Emptyf(t, plan.Statements, "up to date")
+}
+
+func columnType(t *testing.T, migrator gorm.Migrator, name string) string {
+	columnTypes, err := migrator.ColumnTypes(&Gadget{})
+	assert.Nil(t, err)
+	for _, columnType := range columnTypes {
+		if columnType.Name() == name {
+			return columnType.DatabaseTypeName()
+		}
+	}
+	return ""
+}
+
+func TestDestructivePolicy(t *testing.T) {
+	if err := gdb.AutoMigrate(&Gadget{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&Gadget{})
+	})
+	gadgets := []Gadget{{Code: "a", Note: "x"}, {Code: "b", Note: "y"}}
+	if err := gdb.Create(&gadgets).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+
+	production, err := gorm.Open(gormd1.New(gormd1.Config{DSN: defaultDSN, Production: true}), &gorm.Config{})
+	if !assert.Nilf(t, err, "open") {
+		return
+	}
+	assert.ErrorIsf(t, production.Migrator().DropTable(&Gadget{}), gormd1.ErrDestructiveMigration, "drop table")
+	assert.ErrorIsf(t, production.Migrator().DropColumn(&Gadget{}, "Note"), gormd1.ErrDestructiveMigration, "drop column")
+	assert.ErrorIsf(t, production.Migrator().AlterColumn(&Gadget{}, "Size"), gormd1.ErrDestructiveMigration, "rebuild")
+	assert.Truef(t, production.Migrator().HasColumn(&Gadget{}, "note"), "kept")
+	assert.Nilf(t, production.Migrator().DropTable("missing_table"), "nothing to drop")
+
+	var backups []gormd1.Backup
+	backedUp, err := gorm.Open(gormd1.New(gormd1.Config{
+		DSN:               defaultDSN,
+		Production:        true,
+		DestructivePolicy: gormd1.DestructiveBackup,
+		OnBackup: func(backup gormd1.Backup) {
+			backups = append(backups, backup)
+		},
+	}), &gorm.Config{})
+	if !assert.Nilf(t, err, "open") {
+		return
+	}
+	if err := backedUp.Migrator().DropColumn(&Gadget{}, "Note"); !assert.Nilf(t, err, "drop column") {
+		return
+	}
+	if !assert.Len(t, backups, 1) {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(backups[0].BackupTable)
+	})
+	assert.Equal(t, "drop column", backups[0].Operation)
+	assert.Equal(t, "gadgets", backups[0].Table)
+	assert.NotEmptyf(t, backups[0].Bookmark, "bookmark")
+	assert.Regexp(t, `^_backup_gadgets_\d{14}$`, backups[0].BackupTable)
+
+	var notes []string
+	gdb.Table(backups[0].BackupTable).Order("id").Pluck("note", &notes)
+	assert.Equalf(t, []string{"x", "y"}, notes, "rows backed up")
+}
+
+func TestCheckSchema(t *testing.T) {
+	report, err := gormd1.CheckSchema(gdb, &Gadget{})
+	if !assert.Nilf(t, err, "check") {
+		return
+	}
+	assert.Equal(t, []gormd1.SchemaDiff{{Kind: gormd1.DiffMissingTable, Table: "gadgets"}}, report.Diffs)
+
+	if err := gdb.AutoMigrate(&Gadget{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&Gadget{})
+	})
+	report, err = gormd1.CheckSchema(gdb, &Gadget{})
+	if assert.Nilf(t, err, "check") {
+		assert.Truef(t, report.OK(), "migrated: %s", report)
+	}
+
+	report, err = gormd1.CheckSchema(gdb, &GadgetV2{})
+	if !assert.Nilf(t, err, "check") {
+		return
+	}
+	assert.ErrorIs(t, report.Err(), gormd1.ErrSchemaDrift)
+	assert.Equal(t, []gormd1.SchemaDiff{
+		{Kind: gormd1.DiffMissingColumn, Table: "gadgets", Column: "weight"},
+		{Kind: gormd1.DiffColumnType, Table: "gadgets", Column: "size", Expected: "text", Actual: "integer"},
+		{Kind: gormd1.DiffMissingIndex, Table: "gadgets", Index: "idx_gadgets_weight", Expected: "(weight)"},
+	}, report.Diffs)
+	assert.Falsef(t, gdb.Migrator().HasColumn(&GadgetV2{}, "weight"), "nothing changed")
+}
+
+func TestViewsAndTriggers(t *testing.T) {
+	if err := gdb.AutoMigrate(&Gadget{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	migrator := gdb.Migrator().(gormd1.Migrator)
+	t.Cleanup(func() {
+		migrator.DropView("large_gadgets")
+		migrator.DropView("large_codes")
+		gdb.Migrator().DropTable(&Gadget{}, "gadget_audits")
+	})
+	if err := gdb.Exec("CREATE TABLE gadget_audits (gadget_id INTEGER, action TEXT)").Error; !assert.Nilf(t, err, "audit table") {
+		return
+	}
+
+	view := gorm.ViewOption{Query: gdb.Model(&Gadget{}).Select("id", "code", "note").Where("size > ?", 10)}
+	assert.Nilf(t, migrator.CreateView("large_gadgets", view), "create view")
+	assert.Truef(t, migrator.HasView("large_gadgets"), "view created")
+	assert.NotNilf(t, migrator.CreateView("large_gadgets", view), "exists")
+	view.Replace = true
+	view.Query = gdb.Model(&Gadget{}).Select("id", "code", "note").Where("size > ?", 5)
+	assert.Nilf(t, migrator.CreateView("large_gadgets", view), "replace view")
+	assert.Nilf(t, migrator.CreateView("large_codes", gorm.ViewOption{Query: gdb.Table("large_gadgets").Select("code")}), "view of view")
+	assert.NotNilf(t, migrator.CreateView("v", gorm.ViewOption{Query: view.Query, CheckOption: "WITH CHECK OPTION"}), "check option")
+
+	assert.Nilf(t, migrator.CreateTrigger(&Gadget{}, "gadgets_audit_insert", gormd1.TriggerOption{
+		Event: "INSERT",
+		Body:  "INSERT INTO gadget_audits (gadget_id, action) VALUES (NEW.id, 'insert')",
+	}), "create trigger")
+	assert.Nilf(t, migrator.CreateTrigger(&Gadget{}, "gadgets_audit_update", gormd1.TriggerOption{
+		Event: "UPDATE OF color",
+		When:  "OLD.color IS NOT NEW.color",
+		Body:  "INSERT INTO gadget_audits (gadget_id, action) VALUES (NEW.id, 'color');",
+	}), "create trigger")
+	assert.Truef(t, migrator.HasTrigger("gadgets_audit_insert"), "trigger created")
+	triggers, err := migrator.GetTriggers(&Gadget{})
+	assert.Nilf(t, err, "get triggers")
+	if assert.Len(t, triggers, 2) {
+		assert.Equal(t, "gadgets_audit_insert", triggers[0].Name)
+		assert.Equal(t, "gadgets", triggers[0].Table)
+	}
+
+	// rebuilds the table, views and triggers are recreated
+	assert.Nilf(t, migrator.AlterColumn(&Gadget{}, "Size"), "alter column")
+	assert.Truef(t, migrator.HasView("large_gadgets"), "view recreated")
+	assert.Truef(t, migrator.HasView("large_codes"), "view of view recreated")
+	assert.Truef(t, migrator.HasTrigger("gadgets_audit_insert"), "trigger recreated")
+
+	err = migrator.DropColumn(&Gadget{}, "Color")
+	assert.ErrorIsf(t, err, gormd1.ErrColumnInUse, "drop column")
+	assert.Truef(t, migrator.HasColumn(&Gadget{}, "color"), "column kept")
+	assert.Truef(t, migrator.HasTrigger("gadgets_audit_update"), "trigger on the column kept")
+
+	dropping, err := gorm.Open(gormd1.New(gormd1.Config{DSN: defaultDSN, DropDependents: true}), &gorm.Config{})
+	if !assert.Nilf(t, err, "open") {
+		return
+	}
+	assert.Nilf(t, dropping.Migrator().DropColumn(&Gadget{}, "Color"), "drop column and dependents")
+	assert.Falsef(t, migrator.HasTrigger("gadgets_audit_update"), "trigger on the dropped column")
+	assert.Truef(t, migrator.HasTrigger("gadgets_audit_insert"), "trigger kept")
+
+	if err := gdb.Create(&Gadget{Code: "x", Size: 20}).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+	var codes []string
+	gdb.Table("large_codes").Pluck("code", &codes)
+	assert.Equal(t, []string{"x"}, codes)
+	var audits int64
+	gdb.Table("gadget_audits").Count(&audits)
+	assert.Equalf(t, int64(1), audits, "trigger fired")
+
+	assert.Nilf(t, migrator.DropTrigger("gadgets_audit_insert"), "drop trigger")
+	assert.Falsef(t, migrator.HasTrigger("gadgets_audit_insert"), "dropped")
+	assert.Nilf(t, migrator.DropView("large_codes"), "drop view")
+	assert.Falsef(t, migrator.HasView("large_codes"), "dropped")
+}
+
+type Ledger struct {
+	Code  string  `gorm:"primaryKey"`
+	Price float64 `gorm:"check:price >= 0"`
+	Qty   int     `gorm:"check:chk_ledgers_qty,qty > 0"`
+	Total float64 `gorm:"->;generated:price * qty STORED"`
+	At    time.Time
+}
+
+func (Ledger) TableOptions() string {
+	return "STRICT, WITHOUT ROWID"
+}
+
+// LedgerV2 adds a VIRTUAL column, added with ALTER TABLE, and a STORED
+// one, which rebuilds the table.
+type LedgerV2 struct {
+	Code  string  `gorm:"primaryKey"`
+	Price float64 `gorm:"check:price >= 0"`
+	Qty   int     `gorm:"check:chk_ledgers_qty,qty > 0"`
+	Total float64 `gorm:"->;generated:price * qty STORED"`
+	At    time.Time
+	Label string  `gorm:"->;generated:upper(code)"`
+	Tax   float64 `gorm:"->;generated:price * qty / 5 STORED"`
+}
+
+func (LedgerV2) TableName() string {
+	return "ledgers"
+}
+
+func (LedgerV2) TableOptions() string {
+	return "STRICT, WITHOUT ROWID"
+}
+
+func TestStrictTable(t *testing.T) {
+	if err := gdb.AutoMigrate(&Ledger{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&Ledger{})
+	})
+	rawDDL := func() (ddl string) {
+		gdb.Raw("SELECT sql FROM sqlite_master WHERE type = ? AND name = ?", "table", "ledgers").Row().Scan(&ddl)
+		return ddl
+	}
+	assert.True(t, strings.HasSuffix(rawDDL(), ") STRICT, WITHOUT ROWID"), rawDDL())
+
+	if err := gdb.Create(&Ledger{Code: "a", Price: 2.5, Qty: 4, At: time.Now()}).Error; !assert.Nilf(t, err, "create") {
+		return
+	}
+	assert.NotNilf(t, gdb.Create(&Ledger{Code: "b", Price: -1, Qty: 1}).Error, "price check")
+	assert.NotNilf(t, gdb.Create(&Ledger{Code: "c", Price: 1, Qty: 0}).Error, "qty check")
+
+	if err := gdb.AutoMigrate(&LedgerV2{}); !assert.Nilf(t, err, "migrate v2") {
+		return
+	}
+	ddl := rawDDL()
+	assert.True(t, strings.HasSuffix(ddl, ") STRICT, WITHOUT ROWID"), ddl)
+	assert.Contains(t, ddl, "GENERATED ALWAYS AS (price * qty / 5) STORED")
+	assert.Contains(t, ddl, "CONSTRAINT `chk_ledgers_qty` CHECK (qty > 0)")
+
+	var ledger LedgerV2
+	if assert.Nilf(t, gdb.First(&ledger, "code = ?", "a").Error, "first") {
+		assert.Equal(t, 10.0, ledger.Total)
+		assert.Equal(t, "A", ledger.Label)
+		assert.Equal(t, 2.0, ledger.Tax)
+	}
+
+	report, err := gormd1.CheckSchema(gdb, &LedgerV2{})
+	if assert.Nilf(t, err, "check") {
+		assert.Truef(t, report.OK(), "migrated: %s", report)
+	}
+}
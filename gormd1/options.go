@@ -0,0 +1,97 @@
+package gormd1
+
+import (
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// TableOptioner is implemented by models declaring the options of their
+// table, like "STRICT" or "STRICT, WITHOUT ROWID", see
+// https://www.sqlite.org/stricttables.html and
+// https://www.sqlite.org/withoutrowid.html
+//
+// The columns of STRICT tables are declared with the types they allow.
+// Setting gorm:table_options takes precedence over the model.
+type TableOptioner interface {
+	TableOptions() string
+}
+
+// tableOptions returns the table options declared by the model.
+func tableOptions(model interface{}) string {
+	if optioner, ok := model.(TableOptioner); ok {
+		return strings.TrimSpace(optioner.TableOptions())
+	}
+	return ""
+}
+
+// strictSchema tells whether the model of the schema declares its table
+// STRICT.
+func strictSchema(s *schema.Schema) bool {
+	if s == nil || s.ModelType == nil {
+		return false
+	}
+	return strictOptions(tableOptions(reflect.New(s.ModelType).Interface()))
+}
+
+// strictOptions tells whether the table options include STRICT.
+func strictOptions(options string) bool {
+	for _, option := range strings.Split(options, ",") {
+		if strings.EqualFold(strings.TrimSpace(option), "STRICT") {
+			return true
+		}
+	}
+	return false
+}
+
+// strictType maps a declared type to the one of INTEGER, REAL, TEXT, BLOB
+// and ANY a STRICT table accepts, following its affinity. Types of
+// NUMERIC affinity become ANY, which keeps values as they are.
+func strictType(dataType string) string {
+	if strings.TrimSpace(dataType) == "" {
+		return "any"
+	}
+	switch affinity := affinityOf(dataType); affinity {
+	case "numeric":
+		return "any"
+	default:
+		return affinity
+	}
+}
+
+// affinityOf returns the affinity of a declared type, see
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity
+func affinityOf(dataType string) string {
+	switch upper := strings.ToUpper(dataType); {
+	case strings.Contains(upper, "INT"):
+		return "integer"
+	case strings.Contains(upper, "CHAR"), strings.Contains(upper, "CLOB"), strings.Contains(upper, "TEXT"):
+		return "text"
+	case upper == "" || strings.Contains(upper, "BLOB"):
+		return "blob"
+	case strings.Contains(upper, "REAL"), strings.Contains(upper, "FLOA"), strings.Contains(upper, "DOUB"):
+		return "real"
+	}
+	return "numeric"
+}
+
+// generatedColumn returns the GENERATED ALWAYS clause declared by the
+// `generated` tag of the field, like `gorm:"->;generated:price * qty STORED"`.
+// Columns are VIRTUAL unless the expression ends with STORED.
+func generatedColumn(field *schema.Field) (clause string, stored bool) {
+	expr, ok := field.TagSettings["GENERATED"]
+	if !ok || strings.TrimSpace(expr) == "" {
+		return "", false
+	}
+	expr = strings.TrimSpace(expr)
+	kind := "VIRTUAL"
+	if i := strings.LastIndexAny(expr, " \t\n)"); i > 0 {
+		switch last := strings.ToUpper(expr[i+1:]); last {
+		case "STORED", "VIRTUAL":
+			kind = last
+			expr = strings.TrimSpace(expr[:i+1])
+		}
+	}
+	return "GENERATED ALWAYS AS (" + expr + ") " + kind, kind == "STORED"
+}
@@ -0,0 +1,120 @@
+package gormd1
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kofj/gorm-driver-d1/stdlib"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+type strictModel struct {
+	Code    string `gorm:"primaryKey"`
+	Price   float64
+	Qty     int
+	Total   float64 `gorm:"->;generated:price * qty STORED"`
+	Label   string  `gorm:"->;generated:upper(code)"`
+	Amount  string  `gorm:"type:decimal(10,2)"`
+	Raw     []byte
+	Created string `gorm:"type:datetime"`
+}
+
+func (strictModel) TableOptions() string {
+	return "STRICT, WITHOUT ROWID"
+}
+
+type looseModel struct {
+	Code    string
+	Amount  string `gorm:"type:decimal(10,2)"`
+	Created time.Time
+}
+
+func TestStrictType(t *testing.T) {
+	var tests = map[string]string{
+		"varchar(20)":   "text",
+		"bigint":        "integer",
+		"double":        "real",
+		"blob":          "blob",
+		"decimal(10,2)": "any",
+		"datetime":      "any",
+		"":              "any",
+	}
+	for dataType, expected := range tests {
+		assert.Equalf(t, expected, strictType(dataType), dataType)
+	}
+}
+
+func TestDataTypeOf(t *testing.T) {
+	dialector := Dialector{Config: &Config{}}
+	parsed, err := schema.Parse(&strictModel{}, &sync.Map{}, schema.NamingStrategy{})
+	if !assert.Nil(t, err) {
+		return
+	}
+	var tests = map[string]string{
+		"code":    "text",
+		"price":   "real",
+		"qty":     "integer",
+		"total":   "real GENERATED ALWAYS AS (price * qty) STORED",
+		"label":   "text GENERATED ALWAYS AS (upper(code)) VIRTUAL",
+		"amount":  "any",
+		"raw":     "blob",
+		"created": "any",
+	}
+	for column, expected := range tests {
+		assert.Equalf(t, expected, dialector.DataTypeOf(parsed.FieldsByDBName[column]), column)
+	}
+	assert.False(t, parsed.FieldsByDBName["total"].Creatable, "generated columns are read only")
+
+	loose, err := schema.Parse(&looseModel{}, &sync.Map{}, schema.NamingStrategy{})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "decimal(10,2)", dialector.DataTypeOf(loose.FieldsByDBName["amount"]))
+}
+
+func TestTableOptionsStrict(t *testing.T) {
+	db, err := gorm.Open(New(Config{
+		Conn: sql.OpenDB(stdlib.NewConnector("d1://account:token@00000000-0000-0000-0000-000000000000?verify=off")),
+	}), &gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+	if !assert.Nil(t, err) {
+		return
+	}
+	stmt := &gorm.Statement{DB: db}
+	if !assert.Nil(t, stmt.Parse(&looseModel{})) {
+		return
+	}
+	created, amount := stmt.Schema.FieldsByDBName["created"], stmt.Schema.FieldsByDBName["amount"]
+
+	m := db.Migrator().(Migrator)
+	assert.Equal(t, "datetime", m.FullDataTypeOf(created).SQL)
+	assert.Equal(t, "decimal(10,2)", m.FullDataTypeOf(amount).SQL)
+
+	m = db.Set("gorm:table_options", " STRICT").Migrator().(Migrator)
+	assert.Equal(t, "text", m.FullDataTypeOf(created).SQL, "strict by gorm:table_options")
+	assert.Equal(t, "any", m.FullDataTypeOf(amount).SQL)
+
+	stmt = &gorm.Statement{DB: db}
+	if !assert.Nil(t, stmt.Parse(&strictModel{})) {
+		return
+	}
+	m = db.Set("gorm:table_options", "").Migrator().(Migrator)
+	assert.Equal(t, "decimal(10,2)", m.FullDataTypeOf(stmt.Schema.FieldsByDBName["amount"]).SQL, "gorm:table_options takes precedence")
+}
+
+func TestRebuildKeepsTableOptions(t *testing.T) {
+	parsed, err := parseDDL("CREATE TABLE `items` (`code` text, `price` real CHECK (price >= 0), `qty` integer, " +
+		"`total` real GENERATED ALWAYS AS (price * qty) STORED, PRIMARY KEY (`code`), CONSTRAINT `chk_qty` CHECK (qty > 0)) STRICT, WITHOUT ROWID")
+	if !assert.Nil(t, err) {
+		return
+	}
+	rebuilt := parsed.clone()
+	assert.Nil(t, rebuilt.renameTable("items__temp", "items"))
+	assert.Equal(t, "CREATE TABLE `items__temp` (`code` text, `price` real CHECK (price >= 0), `qty` integer, "+
+		"`total` real GENERATED ALWAYS AS (price * qty) STORED, PRIMARY KEY (`code`), CONSTRAINT `chk_qty` CHECK (qty > 0)) STRICT, WITHOUT ROWID", rebuilt.compile())
+	assert.Equal(t, []string{"`code`", "`price`", "`qty`"}, rebuilt.getColumns(), "generated columns aren't copied")
+}
@@ -0,0 +1,97 @@
+package gormd1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Plan holds the statements a migration would execute, in order.
+type Plan struct {
+	Statements []PlannedStatement
+}
+
+// PlannedStatement is a statement of a plan along with the rows it is
+// estimated to write, counted from the rows the table it copies, updates
+// or indexes holds now.
+type PlannedStatement struct {
+	SQL  string
+	Rows int64
+}
+
+// Rows returns the rows the plan is estimated to write.
+func (p *Plan) Rows() int64 {
+	var rows int64
+	for _, stmt := range p.Statements {
+		rows += stmt.Rows
+	}
+	return rows
+}
+
+// String returns the statements of the plan as a script, statements
+// writing rows are preceded by a comment with the estimate.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, stmt := range p.Statements {
+		if stmt.Rows > 0 {
+			fmt.Fprintf(&b, "-- writes ~%d rows\n", stmt.Rows)
+		}
+		b.WriteString(stmt.SQL)
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// DryRun runs fc with a migrator recording the statements it would
+// execute, the copies of rebuilds and the recreated indexes included,
+// and returns them as a plan. Nothing is written to the database, the
+// migrator still reads the schema from it.
+func (m Migrator) DryRun(fc func(m Migrator) error) (*Plan, error) {
+	return m.record(true, fc)
+}
+
+// PlanAutoMigrate returns the plan of AutoMigrate for the models.
+func (m Migrator) PlanAutoMigrate(models ...interface{}) (*Plan, error) {
+	return m.DryRun(func(m Migrator) error {
+		return m.AutoMigrate(models...)
+	})
+}
+
+// rewrittenTable returns the table whose rows the statement writes, the
+// table updated, indexed or rewritten to drop a column.
+func rewrittenTable(query string) string {
+	tokens, err := tokenize(query)
+	if err != nil || len(tokens) < 3 {
+		return ""
+	}
+
+	switch {
+	case tokens[0].is("UPDATE"):
+		if tokens[1].is("OR") && len(tokens) > 3 {
+			return tokens[3].name()
+		}
+		return tokens[1].name()
+	case tokens[0].is("CREATE") && (tokens[1].is("INDEX") || tokens[1].is("UNIQUE") && tokens[2].is("INDEX")):
+		for i, t := range tokens[:len(tokens)-1] {
+			if t.is("ON") {
+				return tokens[i+1].name()
+			}
+		}
+	case tokens[0].is("ALTER") && len(tokens) > 3 && tokens[3].is("DROP"):
+		return tokens[2].name()
+	}
+	return ""
+}
+
+// estimateRows returns the rows of the table, tables which only exist in
+// the plan have none.
+func (r *recorder) estimateRows(ctx context.Context, table string) int64 {
+	if !r.estimate || table == "" {
+		return 0
+	}
+	var rows int64
+	if err := r.ConnPool.QueryRowContext(ctx, "SELECT count(*) FROM "+quoteIdent(table)).Scan(&rows); err != nil {
+		return 0
+	}
+	return rows
+}
@@ -0,0 +1,394 @@
+package gormd1
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	d1 "github.com/kofj/gorm-driver-d1"
+	"github.com/kofj/gorm-driver-d1/stdlib"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deferForeignKeys starts the batches changing tables, foreign keys are
+// checked at the end of the batch instead of by every statement, see
+// https://developers.cloudflare.com/d1/sql-api/foreign-keys/
+const deferForeignKeys = "PRAGMA defer_foreign_keys = true"
+
+// defaultRebuildChunkSize keeps every copy statement of a rebuild well
+// within D1's time limit of a query.
+const defaultRebuildChunkSize = 10000
+
+func (m Migrator) config() *Config {
+	if dialector, ok := m.Dialector.(*Dialector); ok && dialector.Config != nil {
+		return dialector.Config
+	}
+	return &Config{}
+}
+
+func (m Migrator) context() context.Context {
+	if m.DB.Statement != nil && m.DB.Statement.Context != nil {
+		return m.DB.Statement.Context
+	}
+	return context.Background()
+}
+
+// rowidAlias returns the INTEGER PRIMARY KEY column of the table, which
+// is an alias of its rowid, see https://www.sqlite.org/lang_createtable.html#rowid
+func rowidAlias(table *ddl) string {
+	for _, option := range table.options {
+		if option == "WITHOUT ROWID" {
+			return ""
+		}
+	}
+	for _, column := range table.columns {
+		if column.constraint(constraintPrimaryKey) != nil && strings.EqualFold(column.dataType, "INTEGER") {
+			return column.name
+		}
+	}
+	for _, constraint := range table.constraints {
+		if constraint.kind == constraintPrimaryKey && len(constraint.columns) == 1 {
+			if column := table.column(constraint.columns[0]); column != nil && strings.EqualFold(column.dataType, "INTEGER") {
+				return column.name
+			}
+		}
+	}
+	return ""
+}
+
+func hasRowid(table *ddl) bool {
+	for _, option := range table.options {
+		if option == "WITHOUT ROWID" {
+			return false
+		}
+	}
+	return true
+}
+
+// copyColumns returns the columns inserted into dst and selected from the
+// origin table, and the key rows are copied in order of. The key is empty
+// when the tables have no rowid in common, the copy can't resume then.
+func copyColumns(origin *ddl, dst *ddl) (insert, sel, key string) {
+	var selected []string
+	for _, column := range dst.columns {
+		if column.generated() {
+			continue
+		}
+		if expr, ok := dst.copies[column.name]; ok {
+			selected = append(selected, expr)
+		} else {
+			selected = append(selected, quoteIdent(column.name))
+		}
+	}
+	insert = strings.Join(dst.getColumns(), ",")
+	sel = strings.Join(selected, ",")
+	if alias := rowidAlias(dst); alias != "" {
+		return insert, sel, quoteIdent(alias)
+	}
+	if hasRowid(origin) && hasRowid(dst) {
+		return "rowid," + insert, "rowid," + sel, "rowid"
+	}
+	return insert, sel, ""
+}
+
+// copyRows copies the rows of src into the new table dst in chunks keyed
+// by rowid. The rowids are kept, so the rows copied by an interrupted
+// rebuild are skipped when it's resumed.
+func (m Migrator) copyRows(src string, origin *ddl, dst *ddl) error {
+	insert, sel, key := copyColumns(origin, dst)
+	copySQL := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", quoteIdent(dst.table), insert, sel, quoteIdent(src))
+	if rec := m.recorder(); rec != nil {
+		// a recorded rebuild runs once the migration is applied, copy in
+		// one statement
+		if err := m.DB.Exec(copySQL).Error; err != nil {
+			return err
+		}
+		rec.plan.Statements[len(rec.plan.Statements)-1].Rows = rec.estimateRows(m.context(), src)
+		return nil
+	}
+	if key == "" {
+		// no rowid to resume from, copy in one statement
+		return m.DB.Exec(copySQL).Error
+	}
+
+	config := m.config()
+	chunkSize := config.RebuildChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultRebuildChunkSize
+	}
+
+	var (
+		total, copied int64
+		last          sql.NullInt64
+	)
+	if err := m.DB.Raw(fmt.Sprintf("SELECT count(*) FROM %s", quoteIdent(src))).Row().Scan(&total); err != nil {
+		return err
+	}
+	if err := m.DB.Raw(fmt.Sprintf("SELECT count(*), max(%s) FROM %s", key, quoteIdent(dst.table))).Row().Scan(&copied, &last); err != nil {
+		return err
+	}
+	if copied > 0 {
+		d1.Trace("rebuilding %s: resuming after %d rows", src, copied)
+	}
+
+	for {
+		// keys are inlined, params are sent as JSON numbers and would lose
+		// the precision of large integers
+		var where string
+		if last.Valid {
+			where = fmt.Sprintf(" WHERE %s > %d", key, last.Int64)
+		}
+		result := m.DB.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s%s ORDER BY %s LIMIT %d",
+			quoteIdent(dst.table), insert, sel, quoteIdent(src), where, key, chunkSize))
+		if result.Error != nil {
+			return result.Error
+		}
+		copied += result.RowsAffected
+		if config.RebuildProgress != nil {
+			config.RebuildProgress(src, copied, total)
+		}
+		if result.RowsAffected < int64(chunkSize) {
+			return nil
+		}
+
+		if err := m.DB.Raw(fmt.Sprintf("SELECT max(%s) FROM %s", key, quoteIdent(dst.table))).Row().Scan(&last); err != nil {
+			return err
+		}
+	}
+}
+
+// catchUpSQL copies the rows inserted into src since they were copied into
+// dst, it's part of the batch swapping the tables. Rows updated or deleted
+// meanwhile aren't caught up, nor are rows of tables without rowid.
+func catchUpSQL(src string, origin *ddl, dst *ddl) string {
+	insert, sel, key := copyColumns(origin, dst)
+	if key == "" {
+		return ""
+	}
+	last := fmt.Sprintf("(SELECT max(%s) FROM %s)", key, quoteIdent(dst.table))
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s IS NULL OR %s > %s",
+		quoteIdent(dst.table), insert, sel, quoteIdent(src), last, key, last)
+}
+
+// execBatch executes the statements in one D1 batch, which is atomic,
+// falling back to a transaction when the connection isn't a d1 one.
+func (m Migrator) execBatch(stmts []string) error {
+	isD1, err := m.withConn(func(c *stdlib.Conn) error {
+		batch := make([]d1.ParameterizedStatement, 0, len(stmts))
+		for _, stmt := range stmts {
+			batch = append(batch, d1.ParameterizedStatement{SQL: stmt})
+		}
+		_, err := c.WriteBatchContext(m.context(), batch)
+		return err
+	})
+	if isD1 || err != nil {
+		return err
+	}
+
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// withConn runs fc with the d1 connection of the migrator, it tells
+// whether there was one, which isn't the case within transactions, with
+// other drivers or when recording.
+func (m Migrator) withConn(fc func(c *stdlib.Conn) error) (bool, error) {
+	sqlDB, ok := m.DB.Statement.ConnPool.(*sql.DB)
+	if !ok || m.DB.DryRun {
+		return false, nil
+	}
+	conn, err := sqlDB.Conn(m.context())
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var isD1 bool
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return nil
+		}
+		isD1 = true
+		return fc(c)
+	})
+	return isD1, err
+}
+
+// checkReferences fails with ErrReferencedTable when foreign keys of other
+// tables reference the table with ON DELETE actions. The rebuild drops the
+// table, which deletes its rows and runs the actions, cascading deletes
+// included, on the rows referencing them.
+func (m Migrator) checkReferences(table string) error {
+	var names []string
+	if err := m.DB.Raw(
+		"SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name <> ? ORDER BY name", table,
+	).Scan(&names).Error; err != nil {
+		return err
+	}
+
+	var referencing []string
+	for _, name := range names {
+		rawDDL, err := m.getRawDDL(name)
+		if err != nil {
+			return err
+		}
+		if !mentionsName(rawDDL, map[string]bool{strings.ToLower(table): true}) {
+			continue
+		}
+		parsed, err := parseDDL(rawDDL)
+		if err != nil {
+			return err
+		}
+		if action := onDeleteOf(parsed, table); action != "" {
+			referencing = append(referencing, fmt.Sprintf("%s (ON DELETE %s)", name, action))
+		}
+	}
+	if len(referencing) > 0 {
+		return fmt.Errorf("%w: %s is referenced by %s", ErrReferencedTable, table, strings.Join(referencing, ", "))
+	}
+	return nil
+}
+
+// onDeleteOf returns the first ON DELETE action of the foreign keys of the
+// table referencing parent.
+func onDeleteOf(table *ddl, parent string) string {
+	constraints := append([]ddlConstraint{}, table.constraints...)
+	for _, column := range table.columns {
+		constraints = append(constraints, column.constraints...)
+	}
+	for _, constraint := range constraints {
+		if constraint.kind == constraintForeignKey && constraint.onDelete != "" && strings.EqualFold(constraint.expr, parent) {
+			return constraint.onDelete
+		}
+	}
+	return ""
+}
+
+// dependent is an index, trigger or view depending on a table.
+type dependent struct {
+	kind  string
+	name  string
+	table string
+	sql   string
+}
+
+// dependents returns the indexes and triggers of the table, which are
+// dropped along with it, and the views and triggers of other tables
+// referring to it, directly or through views, which would fail renaming
+// the rebuilt table. They are ordered as created.
+func (m Migrator) dependents(table string) ([]dependent, error) {
+	rows, err := m.DB.Raw(
+		"SELECT type, name, tbl_name, sql FROM sqlite_master WHERE type IN ('index', 'trigger', 'view') AND sql IS NOT NULL ORDER BY rowid",
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []dependent
+	for rows.Next() {
+		var object dependent
+		if err := rows.Scan(&object.kind, &object.name, &object.table, &object.sql); err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{strings.ToLower(table): true}
+	taken := make([]bool, len(objects))
+	for changed := true; changed; {
+		changed = false
+		for i, object := range objects {
+			if taken[i] || !(names[strings.ToLower(object.table)] || object.kind != "index" && mentionsName(object.sql, names)) {
+				continue
+			}
+			taken[i] = true
+			if object.kind == "view" {
+				names[strings.ToLower(object.name)] = true
+				changed = true
+			}
+		}
+	}
+
+	var dependents []dependent
+	for i, object := range objects {
+		if taken[i] {
+			dependents = append(dependents, object)
+		}
+	}
+	return dependents, nil
+}
+
+// mentionsName tells whether the sql names any of the lower cased names.
+func mentionsName(sql string, names map[string]bool) bool {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return true
+	}
+	for _, t := range tokens {
+		if (t.kind == tokenWord || t.kind == tokenQuoted) && names[strings.ToLower(t.name())] {
+			return true
+		}
+	}
+	return false
+}
+
+// ForeignKeyViolation is a row reported by PRAGMA foreign_key_check.
+type ForeignKeyViolation struct {
+	Table  string
+	RowID  sql.NullInt64
+	Parent string
+	// FKID is the index of the foreign key in PRAGMA foreign_key_list.
+	FKID int
+}
+
+// ForeignKeyViolations returns the rows of the table violating its
+// foreign keys, as reported by PRAGMA foreign_key_check.
+func (m Migrator) ForeignKeyViolations(value interface{}) ([]ForeignKeyViolation, error) {
+	var violations []ForeignKeyViolation
+	err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		rows, err := m.DB.Raw("PRAGMA foreign_key_check(?)", clause.Table{Name: stmt.Table}).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var violation ForeignKeyViolation
+			if err := rows.Scan(&violation.Table, &violation.RowID, &violation.Parent, &violation.FKID); err != nil {
+				return err
+			}
+			violations = append(violations, violation)
+		}
+		return rows.Err()
+	})
+	return violations, err
+}
+
+// checkForeignKeys verifies the foreign keys of the table, violations are
+// reported as an error matching gorm.ErrForeignKeyViolated.
+func (m Migrator) checkForeignKeys(table string) error {
+	violations, err := m.ForeignKeyViolations(table)
+	if err != nil || len(violations) == 0 {
+		return err
+	}
+
+	var details []string
+	for _, violation := range violations {
+		details = append(details, fmt.Sprintf("%s(rowid=%d) -> %s", violation.Table, violation.RowID.Int64, violation.Parent))
+	}
+	return fmt.Errorf("%w: %s", gorm.ErrForeignKeyViolated, strings.Join(details, ", "))
+}
@@ -0,0 +1,197 @@
+package gormd1
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kofj/gorm-driver-d1/migrate"
+
+	"gorm.io/gorm"
+)
+
+var errRecordingPrepare = errors.New("statements can't be prepared while recording a migration")
+
+// recorder is a connection pool recording the writes of the migrator
+// instead of executing them, reads still query the database.
+type recorder struct {
+	gorm.ConnPool
+	timeFormat string
+	// estimate tells whether the rows written by the statements are
+	// estimated.
+	estimate bool
+	plan     Plan
+	// tables holds the DDL of the tables changed by the recorded
+	// statements, which the database doesn't know of yet.
+	tables map[string]string
+}
+
+func (r *recorder) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errRecordingPrepare
+}
+
+func (r *recorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, err := inlineArgs(query, args, r.timeFormat)
+	if err != nil {
+		return nil, err
+	}
+	r.plan.Statements = append(r.plan.Statements, PlannedStatement{SQL: query, Rows: r.estimateRows(ctx, rewrittenTable(query))})
+	return driver.RowsAffected(0), nil
+}
+
+func (r *recorder) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &recorderTx{r}, nil
+}
+
+// recorderTx records the statements of a transaction, they end up in the
+// same migration.
+type recorderTx struct {
+	*recorder
+}
+
+func (tx *recorderTx) Commit() error {
+	return nil
+}
+
+func (tx *recorderTx) Rollback() error {
+	return nil
+}
+
+// inlineArgs writes the args into the statement as literals, migration
+// files have no params.
+func inlineArgs(query string, args []interface{}, timeFormat string) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '\'', '"', '`':
+			// doubled quotes end up as two adjacent literals
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated literal in %s", query)
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case '?':
+			if len(args) == 0 {
+				return "", fmt.Errorf("missing args of %s", query)
+			}
+			literal, err := sqlLiteral(args[0], timeFormat)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(literal)
+			args = args[1:]
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if len(args) > 0 {
+		return "", fmt.Errorf("too many args of %s", query)
+	}
+	return b.String(), nil
+}
+
+func sqlLiteral(arg interface{}, timeFormat string) (string, error) {
+	value, err := driver.DefaultParameterConverter.ConvertValue(arg)
+	if err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case []byte:
+		return "x'" + hex.EncodeToString(v) + "'", nil
+	case time.Time:
+		return "'" + v.Format(timeFormat) + "'", nil
+	}
+	return "", fmt.Errorf("unsupported arg %T", arg)
+}
+
+// timeFormat is the layout of the times inlined into statements.
+func (m Migrator) timeFormat() string {
+	if format := m.config().DefaultTimeFormat; format != "" {
+		return format
+	}
+	return time.RFC3339Nano
+}
+
+// recorder returns the recorder of the migrator, if it's recording.
+func (m Migrator) recorder() *recorder {
+	switch pool := m.DB.Statement.ConnPool.(type) {
+	case *recorder:
+		return pool
+	case *recorderTx:
+		return pool.recorder
+	}
+	return nil
+}
+
+// record runs fc with a migrator recording its writes instead of executing
+// them and returns them as a plan.
+func (m Migrator) record(estimate bool, fc func(m Migrator) error) (*Plan, error) {
+	tx := m.DB.Session(&gorm.Session{Context: m.context()})
+	rec := &recorder{ConnPool: tx.Statement.ConnPool, timeFormat: m.timeFormat(), estimate: estimate, tables: map[string]string{}}
+	tx.Statement.ConnPool = rec
+	if err := fc(tx.Migrator().(Migrator)); err != nil {
+		return nil, err
+	}
+	return &rec.plan, nil
+}
+
+// recordDDL keeps the DDL of the table in line with the recorded
+// statements, so later rebuilds start from it.
+func (m Migrator) recordDDL(table string, change func(table *ddl) error) error {
+	rec := m.recorder()
+	if rec == nil {
+		return nil
+	}
+	rawDDL, err := m.getRawDDL(table)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseDDL(rawDDL)
+	if err != nil {
+		return err
+	}
+	if err := change(parsed); err != nil {
+		return err
+	}
+	rec.tables[table] = parsed.compile()
+	return nil
+}
+
+// GenerateMigration compares the models to the database and writes the
+// statements AutoMigrate would execute, table rebuilds included, into the
+// next numbered file of the wrangler migrations directory dir instead of
+// executing them. It returns the path of the file, or "" when the
+// database is up to date.
+func (m Migrator) GenerateMigration(dir, name string, models ...interface{}) (string, error) {
+	plan, err := m.record(false, func(m Migrator) error {
+		return m.AutoMigrate(models...)
+	})
+	if err != nil || len(plan.Statements) == 0 {
+		return "", err
+	}
+	return migrate.Create(dir, name, plan.String())
+}
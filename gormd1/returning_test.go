@@ -0,0 +1,60 @@
+package gormd1_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Ticket struct {
+	ID     uint   `gorm:"primaryKey"`
+	Title  string
+	Status string `gorm:"default:open"`
+}
+
+func TestReturningDryRun(t *testing.T) {
+	dry := gdb.Session(&gorm.Session{DryRun: true})
+
+	tx := dry.Create(&[]Ticket{{Title: "a"}, {Title: "b"}})
+	assert.Equal(t, "INSERT INTO `tickets` (`title`,`status`) VALUES (?,?),(?,?) RETURNING `id`", tx.Statement.SQL.String())
+
+	tx = dry.Model(&Ticket{}).Clauses(clause.Returning{}).Where("`status` = ?", "open").Update("status", "closed")
+	assert.Equal(t, "UPDATE `tickets` SET `status`=? WHERE `status` = ? RETURNING *", strings.TrimSpace(tx.Statement.SQL.String()))
+
+	tx = dry.Clauses(clause.Returning{Columns: []clause.Column{{Name: "title"}}}).Where("`id` = ?", 1).Delete(&Ticket{})
+	assert.Equal(t, "DELETE FROM `tickets` WHERE `id` = ? RETURNING `title`", strings.TrimSpace(tx.Statement.SQL.String()))
+}
+
+func TestReturning(t *testing.T) {
+	if err := gdb.AutoMigrate(&Ticket{}); !assert.Nilf(t, err, "migrate") {
+		return
+	}
+	t.Cleanup(func() {
+		gdb.Migrator().DropTable(&Ticket{})
+	})
+
+	tickets := []Ticket{{Title: "a"}, {Title: "b"}, {Title: "c"}, {Title: "d", Status: "closed"}}
+	if err := gdb.CreateInBatches(&tickets, 2).Error; !assert.Nilf(t, err, "create in batches") {
+		return
+	}
+	for idx, ticket := range tickets {
+		assert.NotZerof(t, ticket.ID, "ticket %d id", idx)
+	}
+	assert.Equal(t, "open", tickets[0].Status)
+	assert.Equal(t, "closed", tickets[3].Status)
+
+	var updated []Ticket
+	err := gdb.Model(&updated).Clauses(clause.Returning{}).Where("`status` = ?", "open").Update("status", "closed").Error
+	if assert.Nilf(t, err, "update returning") {
+		assert.Len(t, updated, 3)
+	}
+
+	var deleted []Ticket
+	err = gdb.Model(&deleted).Clauses(clause.Returning{}).Where("`title` = ?", "a").Delete(&deleted).Error
+	if assert.Nilf(t, err, "delete returning") && assert.Len(t, deleted, 1) {
+		assert.Equal(t, tickets[0].ID, deleted[0].ID)
+	}
+}
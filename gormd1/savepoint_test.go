@@ -0,0 +1,60 @@
+package gormd1_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	d1 "github.com/kofj/gorm-driver-d1"
+	"github.com/kofj/gorm-driver-d1/gormd1"
+	"github.com/kofj/gorm-driver-d1/stdlib"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestNestedTransaction(t *testing.T) {
+	const dsn = "d1://account:token@00000000-0000-0000-0000-000000000000?verify=off"
+	db, err := gorm.Open(gormd1.New(gormd1.Config{
+		Conn:            sql.OpenDB(stdlib.NewConnector(dsn + "&tx=batch")),
+		TransactionMode: d1.TransactionBatch,
+	}), &gorm.Config{SkipDefaultTransaction: true})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	errAbort := errors.New("abort")
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&Ticket{Title: "outer"}).Error; err != nil {
+			return err
+		}
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&Ticket{Title: "inner"}).Error; err != nil {
+				return err
+			}
+			return errors.New("rollback inner")
+		})
+		assert.EqualError(t, err, "rollback inner")
+
+		err = tx.Transaction(func(tx *gorm.DB) error {
+			return tx.Create(&Ticket{Title: "kept"}).Error
+		})
+		assert.Nil(t, err)
+
+		// roll back without sending anything
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	db, err = gorm.Open(gormd1.New(gormd1.Config{
+		Conn: sql.OpenDB(stdlib.NewConnector(dsn + "&tx=none")),
+	}), &gorm.Config{SkipDefaultTransaction: true})
+	if !assert.Nil(t, err) {
+		return
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			return nil
+		})
+	})
+	assert.Nil(t, err, "flat without batch mode")
+}
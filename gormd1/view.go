@@ -0,0 +1,132 @@
+package gormd1
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errViewCheckOption = errors.New("view check options are not supported by SQLite")
+
+// CreateView creates the view, SQLite has no CREATE OR REPLACE VIEW so
+// replacing drops the view and creates it again in one batch.
+func (m Migrator) CreateView(name string, option gorm.ViewOption) error {
+	if option.Query == nil {
+		return gorm.ErrSubQueryRequired
+	}
+	if option.CheckOption != "" {
+		return errViewCheckOption
+	}
+
+	stmt := &gorm.Statement{DB: m.DB}
+	stmt.WriteString("CREATE VIEW ")
+	stmt.WriteQuoted(name)
+	stmt.WriteString(" AS ")
+	stmt.AddVar(stmt, option.Query)
+	// views have no params
+	createSQL, err := inlineArgs(stmt.SQL.String(), stmt.Vars, m.timeFormat())
+	if err != nil {
+		return err
+	}
+
+	if !option.Replace {
+		return m.DB.Exec(createSQL).Error
+	}
+	return m.execBatch([]string{fmt.Sprintf("DROP VIEW IF EXISTS %s", quoteIdent(name)), createSQL})
+}
+
+func (m Migrator) DropView(name string) error {
+	return m.DB.Exec("DROP VIEW IF EXISTS ?", clause.Table{Name: name}).Error
+}
+
+func (m Migrator) HasView(name string) bool {
+	var count int
+	m.DB.Raw("SELECT count(*) FROM sqlite_master WHERE type = ? AND name = ?", "view", name).Row().Scan(&count)
+	return count > 0
+}
+
+// TriggerOption declares a trigger, see https://www.sqlite.org/lang_createtrigger.html
+type TriggerOption struct {
+	// Replace drops the trigger first, in the same batch.
+	Replace bool
+	// Timing is BEFORE, AFTER or INSTEAD OF, defaults to AFTER.
+	Timing string
+	// Event is INSERT, DELETE, UPDATE or UPDATE OF followed by columns.
+	Event string
+	// When is an optional condition on the OLD and NEW rows.
+	When string
+	// Body holds the statements run by the trigger, separated by
+	// semicolons.
+	Body string
+}
+
+// Trigger is a trigger of the database.
+type Trigger struct {
+	Name  string
+	Table string
+	SQL   string
+}
+
+// CreateTrigger creates the trigger on the table of value, e.g. to keep
+// audit columns up to date.
+func (m Migrator) CreateTrigger(value interface{}, name string, option TriggerOption) error {
+	if option.Event == "" || strings.TrimSpace(option.Body) == "" {
+		return fmt.Errorf("failed to create trigger %v: event and body are required", name)
+	}
+	timing := option.Timing
+	if timing == "" {
+		timing = "AFTER"
+	}
+	body := strings.TrimSpace(option.Body)
+	if !strings.HasSuffix(body, ";") {
+		body += ";"
+	}
+
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		createSQL := fmt.Sprintf("CREATE TRIGGER %s %s %s ON %s FOR EACH ROW", quoteIdent(name), timing, option.Event, quoteIdent(stmt.Table))
+		if option.When != "" {
+			createSQL += " WHEN " + option.When
+		}
+		createSQL += " BEGIN " + body + " END"
+
+		if !option.Replace {
+			return m.DB.Exec(createSQL).Error
+		}
+		return m.execBatch([]string{fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdent(name)), createSQL})
+	})
+}
+
+func (m Migrator) DropTrigger(name string) error {
+	return m.DB.Exec("DROP TRIGGER IF EXISTS ?", clause.Table{Name: name}).Error
+}
+
+func (m Migrator) HasTrigger(name string) bool {
+	var count int
+	m.DB.Raw("SELECT count(*) FROM sqlite_master WHERE type = ? AND name = ?", "trigger", name).Row().Scan(&count)
+	return count > 0
+}
+
+// GetTriggers returns the triggers of the table of value.
+func (m Migrator) GetTriggers(value interface{}) ([]Trigger, error) {
+	var triggers []Trigger
+	err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		rows, err := m.DB.Raw("SELECT name, tbl_name, sql FROM sqlite_master WHERE type = ? AND tbl_name = ? ORDER BY name", "trigger", stmt.Table).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var trigger Trigger
+			if err := rows.Scan(&trigger.Name, &trigger.Table, &trigger.SQL); err != nil {
+				return err
+			}
+			triggers = append(triggers, trigger)
+		}
+		return rows.Err()
+	})
+	return triggers, err
+}
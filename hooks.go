@@ -0,0 +1,31 @@
+package d1
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Hooks receives driver events, e.g. to feed metrics. All callbacks are
+// optional and must be safe for concurrent use.
+type Hooks struct {
+	// OnQueueWait is called after an api call has been queued by the
+	// account rate limiter, with the time spent waiting.
+	OnQueueWait func(accountId string, wait time.Duration)
+	// OnBreakerStateChange is called when the circuit breaker of the
+	// account changes its state.
+	OnBreakerStateChange func(accountId string, from, to BreakerState)
+}
+
+var currentHooks atomic.Pointer[Hooks]
+
+// SetHooks installs the process wide hooks, replacing the previous ones.
+func SetHooks(h Hooks) {
+	currentHooks.Store(&h)
+}
+
+func getHooks() *Hooks {
+	if h := currentHooks.Load(); h != nil {
+		return h
+	}
+	return &Hooks{}
+}
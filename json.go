@@ -0,0 +1,119 @@
+package d1
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// isComposite reports whether v is a map, slice, array or struct which has
+// to be sent as JSON text, D1 rejects nested JSON values as params.
+func isComposite(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	if _, ok := v.(driver.Valuer); ok {
+		return false
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return false
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map, reflect.Array:
+		return true
+	case reflect.Slice:
+		return rv.Type().Elem().Kind() != reflect.Uint8
+	case reflect.Struct:
+		return rv.Type() != timeType
+	}
+	return false
+}
+
+func marshalComposite(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("d1: encoding %T param as json: %w", v, err)
+	}
+	return string(b), nil
+}
+
+// ValueConverter converts params the way database/sql does, except maps,
+// slices and structs which are encoded as JSON text.
+var ValueConverter driver.ValueConverter = valueConverter{}
+
+type valueConverter struct{}
+
+func (valueConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if isComposite(v) {
+		return marshalComposite(v)
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+// JSON wraps a value stored as JSON text, so it can be queried with
+// SQLite's JSON functions, e.g. json_extract.
+//
+//	type User struct {
+//		Tags d1.JSON[[]string]
+//	}
+type JSON[T any] struct {
+	Data T
+}
+
+// NewJSON wraps v to be stored as JSON text.
+func NewJSON[T any](v T) JSON[T] {
+	return JSON[T]{Data: v}
+}
+
+// Value implements the driver.Valuer interface.
+func (j JSON[T]) Value() (driver.Value, error) {
+	return marshalComposite(j.Data)
+}
+
+// Scan implements the sql.Scanner interface.
+func (j *JSON[T]) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		var zero T
+		j.Data = zero
+		return nil
+	case string:
+		data = []byte(src)
+	case []byte:
+		data = src
+	default:
+		return fmt.Errorf("d1: can't scan %T into JSON", src)
+	}
+	if len(data) == 0 {
+		var zero T
+		j.Data = zero
+		return nil
+	}
+	return json.Unmarshal(data, &j.Data)
+}
+
+// MarshalJSON encodes the wrapped value only.
+func (j JSON[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.Data)
+}
+
+// UnmarshalJSON decodes into the wrapped value.
+func (j *JSON[T]) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &j.Data)
+}
+
+// GormDataType declares the column type for gorm.
+func (JSON[T]) GormDataType() string {
+	return "json"
+}
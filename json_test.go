@@ -0,0 +1,69 @@
+package d1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueConverter(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	rows := []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{map[string]interface{}{"a": 1}, `{"a":1}`},
+		{[]string{"a", "b"}, `["a","b"]`},
+		{[2]int{1, 2}, `[1,2]`},
+		{point{1, 2}, `{"X":1,"Y":2}`},
+		{&point{3, 4}, `{"X":3,"Y":4}`},
+		{[]byte("raw"), []byte("raw")},
+		{int(7), int64(7)},
+		{"text", "text"},
+		{nil, nil},
+	}
+	for _, row := range rows {
+		value, err := ValueConverter.ConvertValue(row.value)
+		if !assert.Nilf(t, err, "convert %#v", row.value) {
+			continue
+		}
+		assert.Equalf(t, row.expected, value, "convert %#v", row.value)
+	}
+
+	now := time.Now()
+	value, err := ValueConverter.ConvertValue(now)
+	assert.Nil(t, err)
+	assert.Equal(t, now, value)
+}
+
+func TestJSON(t *testing.T) {
+	tags := NewJSON([]string{"go", "d1"})
+	value, err := tags.Value()
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, `["go","d1"]`, value)
+
+	var scanned JSON[[]string]
+	assert.Nil(t, scanned.Scan(value))
+	assert.Equal(t, tags, scanned)
+	assert.Nil(t, scanned.Scan([]byte(`["sql"]`)))
+	assert.Equal(t, []string{"sql"}, scanned.Data)
+	assert.Nil(t, scanned.Scan(nil))
+	assert.Nil(t, scanned.Data)
+	assert.NotNil(t, scanned.Scan(int64(1)))
+
+	var m JSON[map[string]int]
+	assert.Nil(t, m.Scan(`{"a":1}`))
+	assert.Equal(t, map[string]int{"a": 1}, m.Data)
+}
+
+func TestConvertParams(t *testing.T) {
+	c := &Connection{}
+	params := []interface{}{[]string{"a"}, map[string]bool{"ok": true}, 1}
+	assert.Nil(t, c.convertParams(params))
+	assert.Equal(t, []interface{}{`["a"]`, `{"ok":true}`, 1}, params)
+}
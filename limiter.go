@@ -0,0 +1,131 @@
+package d1
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// accountLimiter throttles api calls of an account with a token bucket and
+// caps the requests in flight. It's shared by every Connection using the
+// same account, as Cloudflare rate limits the account as a whole.
+type accountLimiter struct {
+	accountId string
+
+	mu     sync.Mutex
+	rate   float64 // tokens per second, 0 means unlimited
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	inflight chan struct{} // nil means unlimited
+}
+
+var accountLimiters = struct {
+	mu sync.Mutex
+	m  map[string]*accountLimiter
+}{m: map[string]*accountLimiter{}}
+
+// limiterFor returns the limiter of the account, creating it with the given
+// settings. The first Connection of an account decides its settings, later
+// ones asking for other settings fail instead of being silently ignored.
+func limiterFor(accountId string, rate float64, burst, maxInflight int) (*accountLimiter, error) {
+	accountLimiters.mu.Lock()
+	defer accountLimiters.mu.Unlock()
+
+	if burst <= 0 {
+		burst = 1
+	}
+	if l, ok := accountLimiters.m[accountId]; ok {
+		if l.rate != rate || l.burst != float64(burst) || cap(l.inflight) != maxInflight {
+			return nil, fmt.Errorf("invalid rate_limit specified: account %s is already limited with rate_limit=%v, rate_burst=%v, max_inflight=%d",
+				accountId, l.rate, l.burst, cap(l.inflight))
+		}
+		return l, nil
+	}
+
+	l := &accountLimiter{
+		accountId: accountId,
+		rate:      rate,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+		last:      time.Now(),
+	}
+	if maxInflight > 0 {
+		l.inflight = make(chan struct{}, maxInflight)
+	}
+	accountLimiters.m[accountId] = l
+	return l, nil
+}
+
+// reserve takes a token and returns how long the caller has to wait
+// before using it.
+func (l *accountLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel gives back a token reserved by a caller which gave up waiting.
+func (l *accountLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
+
+// wait blocks until the api call is allowed to be sent, or ctx is done.
+// The returned release func must be called once the call is finished.
+func (l *accountLimiter) wait(ctx context.Context) (release func(), err error) {
+	var start = time.Now()
+	defer func() {
+		if waited := time.Since(start); err == nil && waited > time.Millisecond {
+			if h := getHooks(); h.OnQueueWait != nil {
+				h.OnQueueWait(l.accountId, waited)
+			}
+		}
+	}()
+
+	if l.rate > 0 {
+		if delay := l.reserve(); delay > 0 {
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				l.cancel()
+				return nil, fmt.Errorf("d1: rate limit wait of %s exceeds context deadline: %w", delay, context.DeadlineExceeded)
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				l.cancel()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	if l.inflight == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.inflight <- struct{}{}:
+		return func() { <-l.inflight }, nil
+	case <-ctx.Done():
+		if l.rate > 0 {
+			l.cancel()
+		}
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,92 @@
+package d1
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterShared(t *testing.T) {
+	a, err := limiterFor("shared-account", 10, 2, 0)
+	assert.Nil(t, err)
+	b, err := limiterFor("shared-account", 10, 2, 0)
+	assert.Nil(t, err)
+	assert.Same(t, a, b, "limiter should be shared per account")
+
+	_, err = limiterFor("shared-account", 100, 20, 5)
+	assert.NotNil(t, err, "conflicting settings")
+}
+
+func TestLimiterRate(t *testing.T) {
+	var waits atomic.Int64
+	SetHooks(Hooks{OnQueueWait: func(accountId string, wait time.Duration) {
+		waits.Add(1)
+	}})
+	defer SetHooks(Hooks{})
+
+	l, err := limiterFor("rate-account", 20, 1, 0)
+	if !assert.Nil(t, err) {
+		return
+	}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := l.wait(context.Background())
+		if !assert.Nil(t, err) {
+			return
+		}
+		release()
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	assert.Equal(t, int64(2), waits.Load())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = l.wait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLimiterInflight(t *testing.T) {
+	l, err := limiterFor("inflight-account", 0, 0, 1)
+	if !assert.Nil(t, err) {
+		return
+	}
+	release, err := l.wait(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.wait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	release, err = l.wait(context.Background())
+	assert.Nil(t, err)
+	release()
+}
+
+func TestLimiterInflightCancel(t *testing.T) {
+	l, err := limiterFor("inflight-cancel-account", 0.001, 2, 1)
+	if !assert.Nil(t, err) {
+		return
+	}
+	release, err := l.wait(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.wait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	release()
+
+	l.mu.Lock()
+	tokens := l.tokens
+	l.mu.Unlock()
+	assert.InDelta(t, 1, tokens, 0.01, "token given back")
+}
@@ -0,0 +1,181 @@
+package d1
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// D1 limits of a single statement, see
+// https://developers.cloudflare.com/d1/platform/limits/
+const (
+	defaultMaxParams    = 100
+	defaultMaxSQLLength = 100000
+)
+
+const (
+	LimitParams    = "params"
+	LimitSQLLength = "sql_length"
+)
+
+var ErrLimitExceeded = errors.New("d1: statement exceeds limits")
+
+// LimitError is returned before sending a statement which would be
+// rejected by D1 for exceeding one of its limits.
+type LimitError struct {
+	// Limit is LimitParams or LimitSQLLength.
+	Limit string
+	Value int
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("d1: statement exceeds %s limit: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// Limits of a statement checked before it is sent, zero values disable
+// the check.
+type Limits struct {
+	MaxParams    int
+	MaxSQLLength int
+}
+
+func (l Limits) check(stmt ParameterizedStatement) error {
+	if l.MaxParams > 0 && len(stmt.Params) > l.MaxParams {
+		return &LimitError{Limit: LimitParams, Value: len(stmt.Params), Max: l.MaxParams}
+	}
+	if l.MaxSQLLength > 0 && len(stmt.SQL) > l.MaxSQLLength {
+		return &LimitError{Limit: LimitSQLLength, Value: len(stmt.SQL), Max: l.MaxSQLLength}
+	}
+	return nil
+}
+
+var errNotSplittable = errors.New("d1: statement is not a splittable multi-row insert")
+
+// splitInsert rewrites a multi-row `INSERT ... VALUES (...), (...)` into
+// several statements complying with the limits. The parts before and after
+// the rows, e.g. `ON CONFLICT` or `RETURNING`, are repeated in every
+// statement along with their params.
+func (l Limits) splitInsert(stmt ParameterizedStatement) ([]ParameterizedStatement, error) {
+	sql := stmt.SQL
+	head := strings.TrimSpace(strings.ToUpper(sql))
+	if !strings.HasPrefix(head, "INSERT") && !strings.HasPrefix(head, "REPLACE") {
+		return nil, errNotSplittable
+	}
+
+	valuesAt := topLevelKeyword(sql, "VALUES")
+	if valuesAt < 0 {
+		return nil, errNotSplittable
+	}
+
+	// locate the rows following VALUES
+	type span struct{ start, end int }
+	var rows []span
+	i := valuesAt + len("VALUES")
+	for {
+		for i < len(sql) && strings.ContainsRune(" \t\r\n", rune(sql[i])) {
+			i++
+		}
+		if i >= len(sql) || sql[i] != '(' {
+			return nil, errNotSplittable
+		}
+		end := closingParen(sql, i)
+		if end < 0 {
+			return nil, errNotSplittable
+		}
+		rows = append(rows, span{i, end})
+
+		i = end
+		for i < len(sql) && strings.ContainsRune(" \t\r\n", rune(sql[i])) {
+			i++
+		}
+		if i < len(sql) && sql[i] == ',' {
+			i++
+			continue
+		}
+		break
+	}
+	if len(rows) < 2 {
+		return nil, errNotSplittable
+	}
+	prefix := sql[:rows[0].start]
+	suffix := sql[rows[len(rows)-1].end:]
+
+	// assign params to the prefix, each row and the suffix
+	placeholders := Placeholders(sql)
+	if len(placeholders) != len(stmt.Params) {
+		return nil, errNotSplittable
+	}
+	var prefixParams, suffixParams []interface{}
+	rowParams := make([][]interface{}, len(rows))
+	for idx, p := range placeholders {
+		if p.Name != "" {
+			// numbered and named params can't be moved between statements
+			return nil, errNotSplittable
+		}
+		param := stmt.Params[idx]
+		switch {
+		case p.Start < rows[0].start:
+			prefixParams = append(prefixParams, param)
+		case p.Start >= rows[len(rows)-1].end:
+			suffixParams = append(suffixParams, param)
+		default:
+			for r, row := range rows {
+				if p.Start >= row.start && p.Start < row.end {
+					rowParams[r] = append(rowParams[r], param)
+					break
+				}
+			}
+		}
+	}
+
+	var (
+		stmts  []ParameterizedStatement
+		sb     strings.Builder
+		params []interface{}
+		count  int
+	)
+	flush := func() {
+		sb.WriteString(suffix)
+		params = append(params, suffixParams...)
+		stmts = append(stmts, ParameterizedStatement{SQL: sb.String(), Params: params})
+		sb.Reset()
+		params, count = nil, 0
+	}
+	for r, row := range rows {
+		rowSQL := sql[row.start:row.end]
+		fits := func() bool {
+			var (
+				sqlLength = sb.Len() + len(", ") + len(rowSQL) + len(suffix)
+				numParams = len(params) + len(rowParams[r]) + len(suffixParams)
+			)
+			return (l.MaxParams <= 0 || numParams <= l.MaxParams) &&
+				(l.MaxSQLLength <= 0 || sqlLength <= l.MaxSQLLength)
+		}
+		if count > 0 && !fits() {
+			flush()
+		}
+		if count == 0 {
+			sb.WriteString(prefix)
+			params = append(params, prefixParams...)
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(rowSQL)
+		params = append(params, rowParams[r]...)
+		count++
+	}
+	flush()
+
+	for _, s := range stmts {
+		if err := l.check(s); err != nil {
+			// a single row exceeds the limits already
+			return nil, err
+		}
+	}
+	return stmts, nil
+}
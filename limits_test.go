@@ -0,0 +1,63 @@
+package d1
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	limits := Limits{MaxParams: 2, MaxSQLLength: 20}
+	assert.Nil(t, limits.check(ParameterizedStatement{SQL: "SELECT ?, ?", Params: []interface{}{1, 2}}))
+
+	err := limits.check(ParameterizedStatement{SQL: "SELECT ?, ?, ?", Params: []interface{}{1, 2, 3}})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	assert.Equal(t, &LimitError{Limit: LimitParams, Value: 3, Max: 2}, err)
+
+	err = limits.check(ParameterizedStatement{SQL: "SELECT '" + strings.Repeat("x", 20) + "'"})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	assert.Nil(t, Limits{}.check(ParameterizedStatement{SQL: "SELECT ?, ?, ?", Params: []interface{}{1, 2, 3}}))
+}
+
+func TestSplitInsert(t *testing.T) {
+	limits := Limits{MaxParams: 5}
+	stmt := ParameterizedStatement{
+		SQL:    "INSERT INTO `users` (`name`,`age`) VALUES (?,?),(?,?),('a,(b)',?),(?,?) ON CONFLICT (`name`) DO UPDATE SET `age`=? RETURNING `id`",
+		Params: []interface{}{"a", 1, "b", 2, 3, "d", 4, 99},
+	}
+
+	stmts, err := limits.splitInsert(stmt)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []ParameterizedStatement{
+		{
+			SQL:    "INSERT INTO `users` (`name`,`age`) VALUES (?,?), (?,?) ON CONFLICT (`name`) DO UPDATE SET `age`=? RETURNING `id`",
+			Params: []interface{}{"a", 1, "b", 2, 99},
+		},
+		{
+			SQL:    "INSERT INTO `users` (`name`,`age`) VALUES ('a,(b)',?), (?,?) ON CONFLICT (`name`) DO UPDATE SET `age`=? RETURNING `id`",
+			Params: []interface{}{3, "d", 4, 99},
+		},
+	}, stmts)
+
+	_, err = limits.splitInsert(ParameterizedStatement{SQL: "UPDATE users SET age = ?", Params: []interface{}{1}})
+	assert.ErrorIs(t, err, errNotSplittable)
+
+	_, err = limits.splitInsert(ParameterizedStatement{SQL: "INSERT INTO t (a) VALUES (?1), (?2)", Params: []interface{}{1, 2}})
+	assert.ErrorIs(t, err, errNotSplittable)
+
+	_, err = Limits{MaxParams: 2}.splitInsert(ParameterizedStatement{SQL: "INSERT INTO t (a,b,c) VALUES (?,?,?),(?,?,?)", Params: make([]interface{}, 6)})
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+}
+
+func TestScanPlaceholders(t *testing.T) {
+	placeholders := Placeholders("SELECT ?, ?12, :name, @id, $v FROM t WHERE a = '?' AND \"b?\" = ? -- ?\n AND c$d = ? /* :x */")
+	var names []string
+	for _, p := range placeholders {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"", "12", ":name", "@id", "$v", "", ""}, names)
+}
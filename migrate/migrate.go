@@ -0,0 +1,312 @@
+// Package migrate applies versioned SQL migrations kept the way wrangler
+// keeps them, `migrations/NNNN_name.sql` files recorded in the
+// d1_migrations table, so `wrangler d1 migrations apply` and Go services
+// share one migration history.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	d1 "github.com/kofj/gorm-driver-d1"
+	"github.com/kofj/gorm-driver-d1/stdlib"
+)
+
+const (
+	// DefaultTable is the migrations table of wrangler.
+	DefaultTable = "d1_migrations"
+	// DefaultDir is the migrations directory of wrangler.
+	DefaultDir = "migrations"
+)
+
+const (
+	// appliedAtFormat is the format of CURRENT_TIMESTAMP.
+	appliedAtFormat = "2006-01-02 15:04:05"
+	// createdAtFormat is the format of the header wrangler writes into
+	// new migration files.
+	createdAtFormat = "2006-01-02T15:04:05.000Z"
+)
+
+type Config struct {
+	// Table records the applied migrations, defaults to d1_migrations,
+	// set it to the migrations_table of wrangler.toml if changed there.
+	Table string
+	// Dir holds the migration files within the file system, defaults to
+	// migrations.
+	Dir string
+}
+
+// Migration is a file named like `0001_create_users.sql`, its name is
+// recorded once applied.
+type Migration struct {
+	Name string
+	SQL  string
+}
+
+// Status of a migration.
+type Status struct {
+	Name string
+	// AppliedAt is zero when the migration is pending.
+	AppliedAt time.Time
+}
+
+func (s Status) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+type Migrator struct {
+	db     *sql.DB
+	fsys   fs.FS
+	config Config
+}
+
+// New returns a migrator applying the migrations of fsys, e.g. an embed.FS
+// or os.DirFS of the wrangler project, to db.
+func New(db *sql.DB, fsys fs.FS, config Config) *Migrator {
+	if config.Table == "" {
+		config.Table = DefaultTable
+	}
+	if config.Dir == "" {
+		config.Dir = DefaultDir
+	}
+	return &Migrator{db: db, fsys: fsys, config: config}
+}
+
+// Migrations returns the migrations ordered by name, files not named
+// `NNNN_name.sql` are ignored.
+func (m *Migrator) Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(m.fsys, m.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() || !isMigrationName(entry.Name()) {
+			continue
+		}
+		content, err := fs.ReadFile(m.fsys, path.Join(m.config.Dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Name: entry.Name(), SQL: string(content)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Name < migrations[j].Name
+	})
+	return migrations, nil
+}
+
+func isMigrationName(name string) bool {
+	number, _, ok := strings.Cut(name, "_")
+	if !ok || number == "" || !strings.HasSuffix(name, ".sql") {
+		return false
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Create writes the next numbered migration file into the directory dir
+// the way `wrangler d1 migrations create` does, e.g.
+// `migrations/0003_add_email.sql`, and returns its path.
+func Create(dir, name, content string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	var number int
+	for _, entry := range entries {
+		if !isMigrationName(entry.Name()) {
+			continue
+		}
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		if n, err := strconv.Atoi(prefix); err == nil && n > number {
+			number = n
+		}
+	}
+	number++
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("%04d_%s.sql", number, strings.ReplaceAll(name, " ", "_")))
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	_, err = fmt.Fprintf(f, "-- Migration number: %04d \t %s\n%s", number, time.Now().UTC().Format(createdAtFormat), content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// Status returns the status of every migration, in order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		statuses = append(statuses, Status{Name: migration.Name, AppliedAt: applied[migration.Name]})
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations not applied yet, in order.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Name]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Apply applies the pending migrations in order and returns the names of
+// the applied ones. Every migration is applied along with its record in
+// one batch, a failing migration leaves no trace and stops the run.
+func (m *Migrator) Apply(ctx context.Context) ([]string, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, migration := range pending {
+		stmts := d1.SplitStatements(migration.SQL)
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO %s (name) VALUES (%s)", m.quotedTable(), quoteString(migration.Name)))
+		if err := m.execBatch(ctx, stmts); err != nil {
+			return names, fmt.Errorf("migration %s failed: %w", migration.Name, err)
+		}
+		d1.Trace("migration %s applied", migration.Name)
+		names = append(names, migration.Name)
+	}
+	return names, nil
+}
+
+func (m *Migrator) quotedTable() string {
+	return `"` + strings.ReplaceAll(m.config.Table, `"`, `""`) + `"`
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// createTable creates the migrations table as wrangler does.
+func (m *Migrator) createTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		name       TEXT UNIQUE,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+)`, m.quotedTable()))
+	return err
+}
+
+// applied returns the applied migrations by name, the table may not exist
+// yet.
+func (m *Migrator) applied(ctx context.Context) (map[string]time.Time, error) {
+	var exists int
+	if err := m.db.QueryRowContext(ctx,
+		"SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", m.config.Table,
+	).Scan(&exists); err != nil {
+		return nil, err
+	}
+	applied := map[string]time.Time{}
+	if exists == 0 {
+		return applied, nil
+	}
+
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf("SELECT name, applied_at FROM %s ORDER BY id", m.quotedTable()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, appliedAt string
+		if err := rows.Scan(&name, &appliedAt); err != nil {
+			return nil, err
+		}
+		at, err := time.Parse(appliedAtFormat, appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid applied_at of migration %s: %w", name, err)
+		}
+		applied[name] = at
+	}
+	return applied, rows.Err()
+}
+
+// execBatch sends the statements as one D1 batch, other drivers run them
+// within a transaction.
+func (m *Migrator) execBatch(ctx context.Context, stmts []string) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	errNotD1 := errors.New("not a d1 connection")
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errNotD1
+		}
+		batch := make([]d1.ParameterizedStatement, 0, len(stmts))
+		for _, stmt := range stmts {
+			batch = append(batch, d1.ParameterizedStatement{SQL: stmt})
+		}
+		_, err := c.WriteBatchContext(ctx, batch)
+		return err
+	})
+	if err != errNotD1 {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
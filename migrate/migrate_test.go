@@ -0,0 +1,289 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_email.sql":    {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+		"migrations/0001_create_users.sql": {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);")},
+		"migrations/0010_seed.sql":         {Data: []byte("INSERT INTO users (name) VALUES ('a');")},
+		"migrations/README.md":             {Data: []byte("# migrations")},
+		"migrations/draft_users.sql":       {Data: []byte("DROP TABLE users;")},
+		"migrations/0003_notes.sql.bak":    {Data: []byte("")},
+		"migrations/0004_dir.sql/x":        {Data: []byte("")},
+		"db/0001_other.sql":                {Data: []byte("SELECT 1;")},
+	}
+
+	migrations, err := New(nil, fsys, Config{}).Migrations()
+	if !assert.Nil(t, err) {
+		return
+	}
+	var names []string
+	for _, migration := range migrations {
+		names = append(names, migration.Name)
+	}
+	assert.Equal(t, []string{"0001_create_users.sql", "0002_add_email.sql", "0010_seed.sql"}, names)
+	assert.Equal(t, "ALTER TABLE users ADD COLUMN email TEXT;", migrations[1].SQL)
+
+	migrations, err = New(nil, fsys, Config{Dir: "db"}).Migrations()
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Len(t, migrations, 1)
+
+	_, err = New(nil, fsys, Config{Dir: "missing"}).Migrations()
+	assert.NotNil(t, err)
+}
+
+func TestQuote(t *testing.T) {
+	m := New(nil, nil, Config{Table: `my"migrations`})
+	assert.Equal(t, `"my""migrations"`, m.quotedTable())
+	assert.Equal(t, `'0001_it''s.sql'`, quoteString("0001_it's.sql"))
+}
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+
+	file, err := Create(dir, "create users", "CREATE TABLE users (id INTEGER PRIMARY KEY);\n")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, filepath.Join(dir, "0001_create_users.sql"), file)
+	content, _ := os.ReadFile(file)
+	assert.Regexp(t, `^-- Migration number: 0001 \t \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}Z\nCREATE TABLE users`, string(content))
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "0009_by_wrangler.sql"), nil, 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "notes.sql"), nil, 0o644))
+	file, err = Create(dir, "add_email", "")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "0010_add_email.sql"), file)
+
+	migrations, err := New(nil, os.DirFS(filepath.Dir(dir)), Config{}).Migrations()
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 3)
+}
+
+// fakeDB is a database/sql driver keeping the statements executed and the
+// migrations recorded, statements containing FAIL fail.
+type fakeDB struct {
+	mu       sync.Mutex
+	table    bool
+	records  []string
+	executed []string
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	db      *fakeDB
+	pending *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare unsupported")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.pending = &fakeDB{}
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.records = append(c.db.records, c.pending.records...)
+	c.db.executed = append(c.db.executed, c.pending.executed...)
+	c.pending = nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+var recordPattern = regexp.MustCompile(`^INSERT INTO "d1_migrations" \(name\) VALUES \('(.*)'\)$`)
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	target := c.db
+	if c.pending != nil {
+		target = c.pending
+	}
+	switch {
+	case strings.Contains(query, "FAIL"):
+		return nil, errors.New("syntax error")
+	case strings.HasPrefix(query, `CREATE TABLE IF NOT EXISTS "d1_migrations"`):
+		c.db.table = true
+	case recordPattern.MatchString(query):
+		target.records = append(target.records, recordPattern.FindStringSubmatch(query)[1])
+	default:
+		target.executed = append(target.executed, query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	rows := &fakeRows{}
+	switch {
+	case strings.Contains(query, "FROM sqlite_master"):
+		rows.columns = []string{"count(*)"}
+		exists := int64(0)
+		if c.db.table {
+			exists = 1
+		}
+		rows.values = [][]driver.Value{{exists}}
+	case strings.HasPrefix(query, `SELECT name, applied_at FROM "d1_migrations"`):
+		rows.columns = []string{"name", "applied_at"}
+		for _, name := range c.db.records {
+			rows.values = append(rows.values, []driver.Value{name, "2024-01-02 03:04:05"})
+		}
+	default:
+		return nil, fmt.Errorf("unexpected query %s", query)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0001_create_users.sql": {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);\nCREATE INDEX idx_users ON users (id);")},
+		"migrations/0002_add_email.sql":    {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+		"migrations/0003_seed.sql":         {Data: []byte("INSERT INTO users (id) VALUES (1);")},
+	}
+	broken := fstest.MapFS{
+		"migrations/0001_create_users.sql": fsys["migrations/0001_create_users.sql"],
+		"migrations/0002_broken.sql":       {Data: []byte("ALTER TABLE users ADD COLUMN a TEXT;\nFAIL;")},
+		"migrations/0003_seed.sql":         fsys["migrations/0003_seed.sql"],
+	}
+
+	var tests = []struct {
+		name     string
+		fsys     fstest.MapFS
+		applied  []string
+		expected []string
+		err      string
+		records  []string
+		executed []string
+	}{
+		{
+			name:     "in order",
+			fsys:     fsys,
+			expected: []string{"0001_create_users.sql", "0002_add_email.sql", "0003_seed.sql"},
+			records:  []string{"0001_create_users.sql", "0002_add_email.sql", "0003_seed.sql"},
+			executed: []string{
+				"CREATE TABLE users (id INTEGER PRIMARY KEY)",
+				"CREATE INDEX idx_users ON users (id)",
+				"ALTER TABLE users ADD COLUMN email TEXT",
+				"INSERT INTO users (id) VALUES (1)",
+			},
+		},
+		{
+			name:     "skips applied",
+			fsys:     fsys,
+			applied:  []string{"0001_create_users.sql", "0003_seed.sql"},
+			expected: []string{"0002_add_email.sql"},
+			records:  []string{"0001_create_users.sql", "0003_seed.sql", "0002_add_email.sql"},
+			executed: []string{"ALTER TABLE users ADD COLUMN email TEXT"},
+		},
+		{
+			name:     "stops on failure",
+			fsys:     broken,
+			expected: []string{"0001_create_users.sql"},
+			err:      "migration 0002_broken.sql failed: syntax error",
+			records:  []string{"0001_create_users.sql"},
+			executed: []string{
+				"CREATE TABLE users (id INTEGER PRIMARY KEY)",
+				"CREATE INDEX idx_users ON users (id)",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeDB{table: test.applied != nil, records: test.applied}
+			m := New(sql.OpenDB(fake), test.fsys, Config{})
+
+			applied, err := m.Apply(context.Background())
+			if test.err == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Equal(t, test.err, err.Error())
+			}
+			assert.Equal(t, test.expected, applied)
+			assert.Equal(t, test.records, fake.records)
+			assert.Equal(t, test.executed, fake.executed)
+
+			statuses, err := m.Status(context.Background())
+			if !assert.Nil(t, err) {
+				return
+			}
+			var pendingNames []string
+			for _, status := range statuses {
+				recorded := false
+				for _, name := range test.records {
+					recorded = recorded || name == status.Name
+				}
+				assert.Equalf(t, recorded, status.Applied(), status.Name)
+				if !recorded {
+					pendingNames = append(pendingNames, status.Name)
+				}
+			}
+			pending, err := m.Pending(context.Background())
+			assert.Nil(t, err)
+			var names []string
+			for _, migration := range pending {
+				names = append(names, migration.Name)
+			}
+			assert.Equal(t, pendingNames, names)
+		})
+	}
+}
+
+func TestStatusWithoutTable(t *testing.T) {
+	m := New(sql.OpenDB(&fakeDB{}), fstest.MapFS{
+		"migrations/0001_create_users.sql": {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);")},
+	}, Config{})
+
+	statuses, err := m.Status(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []Status{{Name: "0001_create_users.sql"}}, statuses)
+
+	pending, err := m.Pending(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+}
@@ -0,0 +1,115 @@
+package d1
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SessionConstraint decides where the first query of a session is served
+// when no bookmark is known yet.
+type SessionConstraint string
+
+const (
+	// SessionFirstPrimary serves the first query by the primary database,
+	// so the session starts from the latest data.
+	SessionFirstPrimary SessionConstraint = "first-primary"
+	// SessionFirstUnconstrained serves the first query by any replica,
+	// trading freshness for latency.
+	SessionFirstUnconstrained SessionConstraint = "first-unconstrained"
+)
+
+const sessionBookmarkHeader = "x-d1-bookmark"
+
+func parseSessionConstraint(s string) (SessionConstraint, error) {
+	switch constraint := SessionConstraint(s); constraint {
+	case SessionFirstPrimary, SessionFirstUnconstrained:
+		return constraint, nil
+	default:
+		return "", fmt.Errorf("invalid session constraint specified: %s", s)
+	}
+}
+
+// Session keeps the bookmark of the D1 Sessions API, every query sent
+// within a session observes the writes of the previous ones, even when
+// served by a read replica.
+//
+// A Session is safe for concurrent use.
+type Session struct {
+	constraint SessionConstraint
+
+	mu       sync.Mutex
+	bookmark string
+}
+
+// NewSession creates a session starting with the given constraint.
+func NewSession(constraint SessionConstraint) *Session {
+	return &Session{constraint: constraint}
+}
+
+// NewSessionFromBookmark resumes a session from a bookmark returned by
+// Session.Bookmark, e.g. one carried by a cookie of a previous request.
+func NewSessionFromBookmark(bookmark string) *Session {
+	return &Session{constraint: SessionFirstUnconstrained, bookmark: bookmark}
+}
+
+// Bookmark returns the latest bookmark seen by the session, it is empty
+// until the first query has been served.
+func (s *Session) Bookmark() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bookmark
+}
+
+// headerValue is sent as bookmark header, the constraint stands in for
+// the bookmark until the first query has been served.
+func (s *Session) headerValue() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bookmark != "" {
+		return s.bookmark
+	}
+	return string(s.constraint)
+}
+
+// update keeps the latest bookmark, bookmarks are lexicographically
+// ordered so responses arriving out of order never move it backwards.
+func (s *Session) update(bookmark string) {
+	if bookmark == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bookmark > s.bookmark {
+		s.bookmark = bookmark
+	}
+}
+
+type sessionCtxKey struct{}
+
+// WithSession returns a copy of ctx carrying the session, statements sent
+// with the returned context are served within the session.
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionCtxKey{}, session)
+}
+
+// SessionFromContext returns the session carried by ctx, or nil.
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionCtxKey{}).(*Session)
+	return session
+}
+
+// Session returns the session of the connection, it's nil unless the
+// session option is set in the dsn.
+func (c *Connection) Session() *Session {
+	return c.session
+}
+
+// sessionFor picks the session a statement is sent within, the one
+// carried by ctx takes precedence over the connection's own.
+func (c *Connection) sessionFor(ctx context.Context) *Session {
+	if session := SessionFromContext(ctx); session != nil {
+		return session
+	}
+	return c.session
+}
@@ -0,0 +1,43 @@
+package d1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionBookmark(t *testing.T) {
+	session := NewSession(SessionFirstPrimary)
+	assert.Equal(t, "", session.Bookmark())
+	assert.Equal(t, string(SessionFirstPrimary), session.headerValue())
+
+	session.update("0000000a-00000002")
+	assert.Equal(t, "0000000a-00000002", session.headerValue())
+
+	session.update("00000009-00000001")
+	assert.Equal(t, "0000000a-00000002", session.Bookmark(), "bookmark moved backwards")
+
+	session.update("")
+	assert.Equal(t, "0000000a-00000002", session.Bookmark())
+
+	resumed := NewSessionFromBookmark(session.Bookmark())
+	assert.Equal(t, session.Bookmark(), resumed.headerValue())
+}
+
+func TestSessionFromContext(t *testing.T) {
+	conn, err := Open("d1://account:token@00000000-0000-0000-0000-000000000000?verify=off&session=first-unconstrained")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotNil(t, conn.Session())
+	assert.Equal(t, conn.Session(), conn.sessionFor(context.Background()))
+
+	session := NewSession(SessionFirstPrimary)
+	ctx := WithSession(context.Background(), session)
+	assert.Equal(t, session, SessionFromContext(ctx))
+	assert.Equal(t, session, conn.sessionFor(ctx))
+
+	_, err = Open("d1://account:token@00000000-0000-0000-0000-000000000000?verify=off&session=latest")
+	assert.NotNil(t, err)
+}
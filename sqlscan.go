@@ -0,0 +1,245 @@
+package d1
+
+import (
+	"strings"
+)
+
+// skipLiteral returns the end of the string literal, quoted identifier or
+// comment starting at i, or i itself when none starts there.
+func skipLiteral(s string, i int) int {
+	switch c := s[i]; c {
+	case '\'', '"', '`':
+		for j := i + 1; j < len(s); j++ {
+			if s[j] == c {
+				if j+1 < len(s) && s[j+1] == c {
+					j++ // escaped quote
+					continue
+				}
+				return j + 1
+			}
+		}
+		return len(s)
+	case '[':
+		if k := strings.IndexByte(s[i+1:], ']'); k >= 0 {
+			return i + k + 2
+		}
+		return len(s)
+	case '-':
+		if i+1 < len(s) && s[i+1] == '-' {
+			if k := strings.IndexByte(s[i:], '\n'); k >= 0 {
+				return i + k + 1
+			}
+			return len(s)
+		}
+	case '/':
+		if i+1 < len(s) && s[i+1] == '*' {
+			if k := strings.Index(s[i+2:], "*/"); k >= 0 {
+				return i + k + 4
+			}
+			return len(s)
+		}
+	}
+	return i
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// Placeholder is a bound parameter found in a statement, Name is empty for
+// anonymous `?`, the digits for `?NNN`, and the full token for `:AAAA`,
+// `@AAAA` and `$AAAA`. Start and End are byte offsets within the statement.
+type Placeholder struct {
+	Start, End int
+	Name       string
+}
+
+// Placeholders lists the bound parameters of sql in order of appearance,
+// skipping string literals, quoted identifiers and comments.
+func Placeholders(sql string) []Placeholder {
+	var placeholders []Placeholder
+	for i := 0; i < len(sql); {
+		if j := skipLiteral(sql, i); j > i {
+			i = j
+			continue
+		}
+
+		switch c := sql[i]; c {
+		case '?':
+			j := i + 1
+			for j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+				j++
+			}
+			placeholders = append(placeholders, Placeholder{Start: i, End: j, Name: sql[i+1 : j]})
+			i = j
+		case ':', '@', '$':
+			j := i + 1
+			for j < len(sql) && isIdentChar(sql[j]) {
+				j++
+			}
+			if j > i+1 {
+				placeholders = append(placeholders, Placeholder{Start: i, End: j, Name: sql[i:j]})
+			}
+			i = j
+		default:
+			if isIdentChar(c) {
+				// skip whole words, e.g. `a$b` is an identifier
+				for i < len(sql) && isIdentChar(sql[i]) {
+					i++
+				}
+				continue
+			}
+			i++
+		}
+	}
+	return placeholders
+}
+
+// topLevelKeyword returns the offset of the first keyword outside of
+// literals, comments and parentheses, or -1.
+func topLevelKeyword(sql string, keyword string) int {
+	var depth int
+	for i := 0; i < len(sql); {
+		if j := skipLiteral(sql, i); j > i {
+			i = j
+			continue
+		}
+
+		c := sql[i]
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case isIdentChar(c):
+			j := i
+			for j < len(sql) && isIdentChar(sql[j]) {
+				j++
+			}
+			if depth == 0 && strings.EqualFold(sql[i:j], keyword) {
+				return i
+			}
+			i = j
+			continue
+		}
+		i++
+	}
+	return -1
+}
+
+// closingParen returns the offset after the parenthesis closing the one
+// at i, or -1 when it is unbalanced.
+func closingParen(sql string, i int) int {
+	var depth int
+	for i < len(sql) {
+		if j := skipLiteral(sql, i); j > i {
+			i = j
+			continue
+		}
+		switch sql[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+		i++
+	}
+	return -1
+}
+
+// SplitStatements splits a script into its statements, dropping empty
+// ones. Semicolons within literals, comments and the BEGIN ... END body
+// of CREATE TRIGGER don't end a statement.
+func SplitStatements(script string) []string {
+	var (
+		stmts   []string
+		start   int
+		words   int  // words of the current statement
+		trigger bool // the statement is a CREATE TRIGGER
+		depth   int  // BEGIN/CASE ... END nesting within a trigger
+	)
+	add := func(end int) {
+		if stmt := strings.TrimSpace(script[start:end]); stmt != "" && words > 0 {
+			stmts = append(stmts, stmt)
+		}
+		start, words, trigger, depth = end+1, 0, false, 0
+	}
+
+	for i := 0; i < len(script); {
+		if j := skipLiteral(script, i); j > i {
+			if script[i] != '-' && script[i] != '/' {
+				words++
+			}
+			i = j
+			continue
+		}
+
+		c := script[i]
+		switch {
+		case c == ';' && depth == 0:
+			add(i)
+		case isIdentChar(c):
+			j := i
+			for j < len(script) && isIdentChar(script[j]) {
+				j++
+			}
+			word := strings.ToUpper(script[i:j])
+			words++
+			switch {
+			case words <= 3 && word == "TRIGGER":
+				// CREATE [TEMP] TRIGGER
+				trigger = true
+			case trigger && (word == "BEGIN" || word == "CASE"):
+				depth++
+			case trigger && word == "END" && depth > 0:
+				depth--
+			}
+			i = j
+			continue
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			words++
+		}
+		i++
+	}
+	add(len(script))
+	return stmts
+}
+
+// IsWrite tells whether the statement may change the database, only
+// SELECT, VALUES and EXPLAIN queries, PRAGMA queries not setting a value
+// and WITH queries ending in a SELECT are known to be read only.
+func IsWrite(sql string) bool {
+	var i int
+	for i < len(sql) {
+		if j := skipLiteral(sql, i); j > i && (sql[i] == '-' || sql[i] == '/') {
+			i = j
+			continue
+		}
+		if c := sql[i]; c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != '(' {
+			break
+		}
+		i++
+	}
+	j := i
+	for j < len(sql) && isIdentChar(sql[j]) {
+		j++
+	}
+
+	switch strings.ToUpper(sql[i:j]) {
+	case "SELECT", "VALUES", "EXPLAIN":
+		return false
+	case "PRAGMA":
+		return strings.Contains(sql, "=")
+	case "WITH":
+		for _, keyword := range []string{"INSERT", "UPDATE", "DELETE", "REPLACE"} {
+			if topLevelKeyword(sql, keyword) >= 0 {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
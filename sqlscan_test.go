@@ -0,0 +1,50 @@
+package d1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- Migration number: 0001
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT DEFAULT 'a;b'); -- trailing; comment
+/* block; comment */
+INSERT INTO "semi;colon" VALUES (1);;
+CREATE TRIGGER users_ai AFTER INSERT ON users BEGIN
+  UPDATE users SET name = CASE WHEN new.name IS NULL THEN 'x' ELSE new.name END WHERE id = new.id;
+  INSERT INTO log VALUES (new.id);
+END;
+CREATE INDEX idx_users_name ON users (name)
+-- only a comment;
+`
+	assert.Equal(t, []string{
+		"-- Migration number: 0001\nCREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT DEFAULT 'a;b')",
+		"-- trailing; comment\n/* block; comment */\nINSERT INTO \"semi;colon\" VALUES (1)",
+		"CREATE TRIGGER users_ai AFTER INSERT ON users BEGIN\n  UPDATE users SET name = CASE WHEN new.name IS NULL THEN 'x' ELSE new.name END WHERE id = new.id;\n  INSERT INTO log VALUES (new.id);\nEND",
+		"CREATE INDEX idx_users_name ON users (name)\n-- only a comment;",
+	}, SplitStatements(script))
+
+	assert.Empty(t, SplitStatements("  -- nothing;\n ; "))
+}
+
+func TestIsWrite(t *testing.T) {
+	var tests = map[string]bool{
+		"SELECT * FROM users":                                false,
+		"  -- comment\n/* block */ select 1":                 false,
+		"(SELECT 1) UNION SELECT 2":                          false,
+		"VALUES (1), (2)":                                    false,
+		"EXPLAIN QUERY PLAN SELECT 1":                        false,
+		"PRAGMA table_info(users)":                           false,
+		"PRAGMA defer_foreign_keys = true":                   true,
+		"WITH t AS (SELECT 1) SELECT * FROM t":               false,
+		"WITH t AS (SELECT 1) INSERT INTO u SELECT * FROM t": true,
+		"INSERT INTO users (name) VALUES (?) RETURNING id":   true,
+		"update users SET name = 'select' RETURNING *":       true,
+		"DELETE FROM users":                                  true,
+		"CREATE TABLE t (id INTEGER)":                        true,
+	}
+	for sql, expected := range tests {
+		assert.Equalf(t, expected, IsWrite(sql), sql)
+	}
+}
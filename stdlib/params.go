@@ -0,0 +1,131 @@
+package stdlib
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	d1 "github.com/kofj/gorm-driver-d1"
+)
+
+// D1 binds anonymous `?` and numbered `?NNN` params only.
+const maxParamNumber = 32766
+
+// binding maps the placeholders of a statement to SQLite's parameter
+// numbers, so named and numbered params can be rewritten into the
+// positional params sent to D1.
+type binding struct {
+	placeholders []d1.Placeholder
+	numbers      []int          // parameter number of each placeholder
+	names        map[int]string // parameter number to name, without prefix
+	numInput     int
+	anonymous    bool // only anonymous `?`, no rewrite needed
+}
+
+// newBinding numbers the placeholders the way SQLite does: `?NNN` takes
+// NNN, a name takes the number of its first appearance, anything else
+// takes one more than the largest number assigned so far.
+func newBinding(query string) (*binding, error) {
+	var b = &binding{
+		placeholders: d1.Placeholders(query),
+		names:        map[int]string{},
+		anonymous:    true,
+	}
+	var byName = map[string]int{}
+
+	for _, p := range b.placeholders {
+		var number int
+		switch {
+		case p.Name == "":
+			number = b.numInput + 1
+		case p.Name[0] >= '0' && p.Name[0] <= '9':
+			n, err := strconv.Atoi(p.Name)
+			if err != nil || n < 1 || n > maxParamNumber {
+				return nil, fmt.Errorf("d1: invalid parameter number ?%s", p.Name)
+			}
+			number = n
+			b.anonymous = false
+		default:
+			b.anonymous = false
+			if n, ok := byName[p.Name]; ok {
+				number = n
+			} else {
+				number = b.numInput + 1
+				byName[p.Name] = number
+				b.names[number] = p.Name[1:]
+			}
+		}
+
+		if number > b.numInput {
+			b.numInput = number
+		}
+		b.numbers = append(b.numbers, number)
+	}
+	return b, nil
+}
+
+// bind rewrites the statement with positional params only, rejecting
+// arguments which don't match its placeholders.
+func (b *binding) bind(query string, args []driver.NamedValue) (d1.ParameterizedStatement, error) {
+	if b.anonymous {
+		for _, arg := range args {
+			if arg.Name != "" {
+				return d1.ParameterizedStatement{}, fmt.Errorf("d1: named argument %s has no matching parameter", arg.Name)
+			}
+		}
+		if len(args) != b.numInput {
+			return d1.ParameterizedStatement{}, fmt.Errorf("d1: expected %d arguments, got %d", b.numInput, len(args))
+		}
+		return d1.ParameterizedStatement{SQL: query, Params: namedValuesToParams(args)}, nil
+	}
+
+	var (
+		values = make([]interface{}, b.numInput+1)
+		bound  = make([]bool, b.numInput+1)
+	)
+	for _, arg := range args {
+		number := arg.Ordinal
+		if arg.Name != "" {
+			number = 0
+			for n, name := range b.names {
+				if name == arg.Name {
+					number = n
+					break
+				}
+			}
+			if number == 0 {
+				return d1.ParameterizedStatement{}, fmt.Errorf("d1: named argument %s has no matching parameter", arg.Name)
+			}
+		} else if number > b.numInput {
+			return d1.ParameterizedStatement{}, fmt.Errorf("d1: expected %d arguments, got %d", b.numInput, len(args))
+		}
+		if bound[number] && arg.Name == "" {
+			// a named argument already took this parameter
+			continue
+		}
+		values[number], bound[number] = arg.Value, true
+	}
+
+	var (
+		sb     strings.Builder
+		params = make([]interface{}, 0, len(b.placeholders))
+		last   int
+	)
+	for idx, p := range b.placeholders {
+		number := b.numbers[idx]
+		if !bound[number] {
+			if name, ok := b.names[number]; ok {
+				return d1.ParameterizedStatement{}, fmt.Errorf("d1: missing argument for parameter %s", name)
+			}
+			return d1.ParameterizedStatement{}, fmt.Errorf("d1: missing argument for parameter ?%d", number)
+		}
+		sb.WriteString(query[last:p.Start])
+		sb.WriteByte('?')
+		last = p.End
+		params = append(params, values[number])
+	}
+	sb.WriteString(query[last:])
+
+	return d1.ParameterizedStatement{SQL: sb.String(), Params: params}, nil
+}
@@ -0,0 +1,96 @@
+package stdlib
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindingNumInput(t *testing.T) {
+	for query, numInput := range map[string]int{
+		"SELECT 1":                               0,
+		"SELECT ?, ?":                            2,
+		"SELECT ?3, ?1":                          3,
+		"SELECT :a, @b, $c, :a":                  3,
+		"SELECT ?, ?5, ?":                        6,
+		"SELECT ':a', \"?\" -- ?\n":              0,
+		"SELECT json_extract(payload, '$.a'), ?": 1,
+	} {
+		b, err := newBinding(query)
+		if !assert.Nilf(t, err, "binding %q", query) {
+			continue
+		}
+		assert.Equalf(t, numInput, b.numInput, "binding %q", query)
+	}
+
+	_, err := newBinding("SELECT ?0")
+	assert.NotNil(t, err)
+}
+
+func TestBindingBind(t *testing.T) {
+	rows := []struct {
+		query  string
+		args   []driver.NamedValue
+		sql    string
+		params []interface{}
+		fail   bool
+	}{
+		{
+			query:  "SELECT * FROM users WHERE id = ? AND name = ?",
+			args:   []driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: "kofj"}},
+			sql:    "SELECT * FROM users WHERE id = ? AND name = ?",
+			params: []interface{}{int64(1), "kofj"},
+		},
+		{
+			query:  "SELECT * FROM users WHERE id = ?2 AND name = ?1 OR alias = ?1",
+			args:   []driver.NamedValue{{Ordinal: 1, Value: "kofj"}, {Ordinal: 2, Value: int64(1)}},
+			sql:    "SELECT * FROM users WHERE id = ? AND name = ? OR alias = ?",
+			params: []interface{}{int64(1), "kofj", "kofj"},
+		},
+		{
+			query:  "SELECT * FROM users WHERE id = :id AND (name = @name OR alias = @name)",
+			args:   []driver.NamedValue{{Name: "name", Ordinal: 1, Value: "kofj"}, {Name: "id", Ordinal: 2, Value: int64(1)}},
+			sql:    "SELECT * FROM users WHERE id = ? AND (name = ? OR alias = ?)",
+			params: []interface{}{int64(1), "kofj", "kofj"},
+		},
+		{
+			query:  "SELECT * FROM users WHERE id = $id AND name = ?",
+			args:   []driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: "kofj"}},
+			sql:    "SELECT * FROM users WHERE id = ? AND name = ?",
+			params: []interface{}{int64(1), "kofj"},
+		},
+		{
+			query: "SELECT * FROM users WHERE id = :id",
+			args:  []driver.NamedValue{{Name: "uid", Ordinal: 1, Value: int64(1)}},
+			fail:  true,
+		},
+		{
+			query: "SELECT * FROM users WHERE id = ?",
+			args:  []driver.NamedValue{{Name: "id", Ordinal: 1, Value: int64(1)}},
+			fail:  true,
+		},
+		{
+			query: "SELECT * FROM users WHERE id = ? AND name = ?",
+			args:  []driver.NamedValue{{Ordinal: 1, Value: int64(1)}},
+			fail:  true,
+		},
+	}
+
+	for _, row := range rows {
+		b, err := newBinding(row.query)
+		if !assert.Nilf(t, err, "binding %q", row.query) {
+			continue
+		}
+		stmt, err := b.bind(row.query, row.args)
+		if row.fail {
+			assert.NotNilf(t, err, "bind %q", row.query)
+			continue
+		}
+		if !assert.Nilf(t, err, "bind %q", row.query) {
+			continue
+		}
+		assert.Equal(t, row.sql, stmt.SQL)
+		assert.Equal(t, row.params, stmt.Params)
+	}
+}
@@ -0,0 +1,87 @@
+package stdlib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errSavepointOutsideTx = errors.New("d1: savepoints require a transaction")
+
+type savepointOp int
+
+const (
+	opSavepoint savepointOp = iota + 1
+	opRelease
+	opRollbackTo
+)
+
+// savepoint marks the number of statements buffered when it was set.
+type savepoint struct {
+	name string
+	mark int
+}
+
+// parseSavepoint recognizes `SAVEPOINT name`, `RELEASE [SAVEPOINT] name`
+// and `ROLLBACK [TRANSACTION] TO [SAVEPOINT] name`, which D1 doesn't
+// support and are emulated on the buffered statements. Unless the
+// connection is in batch mode they are ignored.
+func parseSavepoint(query string) (op savepointOp, name string, ok bool) {
+	fields := strings.Fields(strings.TrimRight(strings.TrimSpace(query), ";"))
+	if len(fields) < 2 {
+		return 0, "", false
+	}
+	keyword := func(s string) bool {
+		if len(fields) > 1 && strings.EqualFold(fields[0], s) {
+			fields = fields[1:]
+			return true
+		}
+		return false
+	}
+
+	switch {
+	case keyword("SAVEPOINT"):
+		op = opSavepoint
+	case keyword("RELEASE"):
+		op = opRelease
+		keyword("SAVEPOINT")
+	case keyword("ROLLBACK"):
+		keyword("TRANSACTION")
+		if !keyword("TO") {
+			return 0, "", false
+		}
+		op = opRollbackTo
+		keyword("SAVEPOINT")
+	default:
+		return 0, "", false
+	}
+	if len(fields) != 1 {
+		return 0, "", false
+	}
+	return op, strings.Trim(fields[0], "`\"[]"), true
+}
+
+func (tx *Tx) savepoint(op savepointOp, name string) error {
+	idx := -1
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if strings.EqualFold(tx.savepoints[i].name, name) {
+			idx = i
+			break
+		}
+	}
+	if op != opSavepoint && idx < 0 {
+		return fmt.Errorf("d1: no such savepoint: %s", name)
+	}
+
+	switch op {
+	case opSavepoint:
+		tx.savepoints = append(tx.savepoints, savepoint{name: name, mark: len(tx.stmts)})
+	case opRelease:
+		tx.savepoints = tx.savepoints[:idx]
+	case opRollbackTo:
+		// the savepoint itself stays, as in SQLite
+		tx.stmts = tx.stmts[:tx.savepoints[idx].mark]
+		tx.savepoints = tx.savepoints[:idx+1]
+	}
+	return nil
+}
@@ -25,6 +25,7 @@ func init() {
 
 // Driver implements the sql/driver.Driver interface.
 var _ driver.Driver = (*Driver)(nil)
+var _ driver.DriverContext = (*Driver)(nil)
 
 type Driver struct{}
 
@@ -33,18 +34,59 @@ func (d *Driver) Open(dsn string) (driver.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Conn{conn}, nil
+	return &Conn{Connection: conn}, nil
+}
+
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	return NewConnector(dsn), nil
+}
+
+// Connector implements the sql/driver.Connector interface, use it with
+// sql.OpenDB to get a *sql.DB without registering a driver name.
+var _ driver.Connector = (*Connector)(nil)
+
+type Connector struct {
+	dsn    string
+	driver *Driver
+}
+
+// NewConnector returns a connector opening connections with the dsn.
+func NewConnector(dsn string) *Connector {
+	return &Connector{dsn: dsn, driver: &Driver{}}
+}
+
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *Connector) Driver() driver.Driver {
+	return c.driver
 }
 
 // Conn implements the sql/driver.Conn interface.
 var _ driver.Conn = (*Conn)(nil)
+var _ driver.NamedValueChecker = (*Conn)(nil)
 
 type Conn struct {
 	*d1.Connection
+
+	tx *Tx // the buffering transaction in progress, if any
 }
 
 func (c *Conn) Prepare(query string) (driver.Stmt, error) {
-	return &Stmt{Stmt: query, Conn: c}, nil
+	binding, err := newBinding(query)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{Stmt: query, Conn: c, binding: binding}, nil
+}
+
+// CheckNamedValue accepts named arguments, which are bound to the named
+// params of the statement, and converts values as database/sql does.
+// Maps, slices and structs are encoded as JSON text.
+func (c *Conn) CheckNamedValue(nv *driver.NamedValue) (err error) {
+	nv.Value, err = d1.ValueConverter.ConvertValue(nv.Value)
+	return err
 }
 
 func (c *Conn) Close() error {
@@ -53,31 +95,90 @@ func (c *Conn) Close() error {
 }
 
 func (c *Conn) Begin() (driver.Tx, error) {
-	return &Tx{}, nil
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if sql.IsolationLevel(opts.Isolation) != sql.LevelDefault {
+		return nil, errors.New("d1: isolation levels are not supported")
+	}
+	if c.TransactionMode() != d1.TransactionBatch {
+		return &Tx{}, nil
+	}
+	if c.tx != nil {
+		return nil, errors.New("d1: transaction already in progress")
+	}
+	c.tx = &Tx{conn: c, ctx: ctx}
+	return c.tx, nil
 }
 
 // Tx implements the sql/driver.Tx interface.
 // this is not required by the driver.
+//
+// Unless the connection is in batch transaction mode it's a no-op,
+// otherwise it buffers written statements and sends them as one batch
+// on commit. Savepoints are emulated by truncating the buffer.
 var _ driver.Tx = (*Tx)(nil)
 
-type Tx struct{}
+type Tx struct {
+	conn       *Conn
+	ctx        context.Context
+	stmts      []d1.ParameterizedStatement
+	savepoints []savepoint
+}
 
 func (tx *Tx) Commit() error {
-	// no-op
+	if tx.conn == nil {
+		// no-op
+		return nil
+	}
+	tx.conn.tx = nil
+	if len(tx.stmts) == 0 {
+		return nil
+	}
+
+	result, err := tx.conn.WriteBatchContext(tx.ctx, tx.stmts)
+	if err != nil {
+		d1.Trace("%s: Commit failed(AuditlogId=%s): %+v", tx.conn.ID, result.AuditlogId, err)
+		return err
+	}
+	d1.Trace("%s: Commit OK(AuditlogId=%s): %d statements", tx.conn.ID, result.AuditlogId, len(tx.stmts))
 	return nil
 }
 
 func (tx *Tx) Rollback() error {
-	// no-op
+	if tx.conn == nil {
+		// no-op
+		return nil
+	}
+	tx.conn.tx = nil
+	tx.stmts = nil
+	tx.savepoints = nil
 	return nil
 }
 
+// pendingResult is returned for statements buffered by a transaction,
+// their outcome is unknown until commit.
+type pendingResult struct{}
+
+func (pendingResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (pendingResult) RowsAffected() (int64, error) {
+	return 0, nil
+}
+
 // Stmt implements the sql/driver.Stmt interface.
 var _ driver.Stmt = (*Stmt)(nil)
+var _ driver.StmtExecContext = (*Stmt)(nil)
+var _ driver.StmtQueryContext = (*Stmt)(nil)
 
 type Stmt struct {
 	Stmt string
 	Conn *Conn
+
+	binding *binding
 }
 
 func (s *Stmt) Close() error {
@@ -85,16 +186,51 @@ func (s *Stmt) Close() error {
 }
 
 func (s *Stmt) NumInput() int {
-	return -1
+	if s.binding == nil {
+		return -1
+	}
+	return s.binding.numInput
+}
+
+func (s *Stmt) bind(args []driver.NamedValue) (d1.ParameterizedStatement, error) {
+	if s.binding == nil {
+		return d1.ParameterizedStatement{SQL: s.Stmt, Params: namedValuesToParams(args)}, nil
+	}
+	return s.binding.bind(s.Stmt, args)
 }
 
 func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
-	a := make([]interface{}, len(args))
-	for i, v := range args {
-		a[i] = v
+	return s.ExecContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if op, name, ok := parseSavepoint(s.Stmt); ok {
+		if s.Conn.TransactionMode() != d1.TransactionBatch {
+			// statements aren't buffered, nested transactions are flat
+			d1.Trace("%s: Exec savepoint ignored: %s", s.Conn.ID, s.Stmt)
+			return pendingResult{}, nil
+		}
+		if s.Conn.tx == nil {
+			return nil, errSavepointOutsideTx
+		}
+		if err := s.Conn.tx.savepoint(op, name); err != nil {
+			return nil, err
+		}
+		d1.Trace("%s: Exec savepoint: %s", s.Conn.ID, s.Stmt)
+		return pendingResult{}, nil
+	}
+
+	stmt, err := s.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	if tx := s.Conn.tx; tx != nil {
+		tx.stmts = append(tx.stmts, stmt)
+		d1.Trace("%s: Exec buffered, %d statements in transaction", s.Conn.ID, len(tx.stmts))
+		return pendingResult{}, nil
 	}
-	var stmt = d1.ParameterizedStatement{SQL: s.Stmt, Params: a}
-	result, err := s.Conn.WriteParameterizedContext(context.Background(), stmt)
+
+	result, err := s.Conn.WriteParameterizedContext(ctx, stmt)
 	if err != nil {
 		d1.Trace("%s: Exec failed(AuditlogId=%s): %+v", s.Conn.ID, result.AuditlogId, err)
 		return nil, err
@@ -105,19 +241,46 @@ func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
 }
 
 func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
-	a := make([]interface{}, len(args))
-	for i, v := range args {
-		a[i] = v
+	return s.QueryContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	stmt, err := s.bind(args)
+	if err != nil {
+		return nil, err
 	}
-	var stmt = d1.ParameterizedStatement{SQL: s.Stmt, Params: a}
-	result, err := s.Conn.WriteParameterizedContext(context.Background(), stmt)
+	// writes of a transaction are buffered until commit, a query writing
+	// would escape the batch, its rollback and its savepoints
+	if s.Conn.tx != nil && d1.IsWrite(stmt.SQL) {
+		return nil, errors.New("d1: writes can't be queried within a batch transaction, e.g. with RETURNING, use Exec")
+	}
+	result, err := s.Conn.WriteParameterizedContext(ctx, stmt)
 	if err != nil {
 		d1.Trace("%s: Query failed: %+v", s.Conn.ID, err)
 		return nil, err
 	}
 	d1.Trace("%s: Query OK: %+v", s.Conn.ID, result)
 
-	return &Rows{connId: s.Conn.ID, results: &result.Result[0].Results}, nil
+	if len(result.Result) == 0 {
+		return &Rows{connId: s.Conn.ID, timeFormat: s.Conn.TimeFormat(), results: &d1.D1RespQueryResults{}}, nil
+	}
+	return &Rows{connId: s.Conn.ID, timeFormat: s.Conn.TimeFormat(), results: &result.Result[0].Results}, nil
+}
+
+func valuesToNamedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+func namedValuesToParams(args []driver.NamedValue) []interface{} {
+	a := make([]interface{}, len(args))
+	for i, v := range args {
+		a[i] = v.Value
+	}
+	return a
 }
 
 // Result implements the sql/driver.Result interface.
@@ -139,9 +302,10 @@ func (r *Result) RowsAffected() (int64, error) {
 var _ driver.Rows = (*Rows)(nil)
 
 type Rows struct {
-	connId  string
-	results *d1.D1RespQueryResults
-	index   int
+	connId     string
+	timeFormat string
+	results    *d1.D1RespQueryResults
+	index      int
 }
 
 func (r *Rows) Columns() []string {
@@ -185,7 +349,7 @@ func (r *Rows) Next(dest []driver.Value) (err error) {
 		case string:
 			sv := row[i].(string)
 			if slices.Contains(defaultTimeFields, strings.ToLower(r.results.Columns[i])) {
-				dest[i], err = time.Parse(time.RFC3339Nano, sv)
+				dest[i], err = time.Parse(r.timeFormat, sv)
 				if err != nil {
 					d1.Trace("Rows.Next parse time string failed: %s", err)
 					return err
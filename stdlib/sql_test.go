@@ -251,6 +251,20 @@ func TestTable(t *testing.T) {
 		})
 	}
 
+	t.Run("Query Named", func(t *testing.T) {
+		var name string
+		err := globalDB.QueryRow("SELECT name FROM "+testTableName()+" WHERE id = :id AND name = ?2",
+			sql.Named("id", items[0].id), items[0].name,
+		).Scan(&name)
+		if !assert.Nilf(t, err, "query: %v", err) {
+			return
+		}
+		assert.Equalf(t, items[0].name, name, "name")
+
+		_, err = globalDB.Query("SELECT name FROM "+testTableName()+" WHERE id = ? AND name = ?", items[0].id)
+		assert.NotNilf(t, err, "expected error for missing argument")
+	})
+
 	t.Run("Invalid Query", func(t *testing.T) {
 		_, err := globalDB.Query("INVALID QUERY")
 		if err == nil {
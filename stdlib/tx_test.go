@@ -0,0 +1,134 @@
+package stdlib
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchTx(t *testing.T) {
+	connector := NewConnector("d1://account:token@00000000-0000-0000-0000-000000000000?verify=off&tx=batch")
+	dc, err := connector.Connect(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+	conn := dc.(*Conn)
+
+	tx, err := conn.BeginTx(context.Background(), driver.TxOptions{})
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = conn.BeginTx(context.Background(), driver.TxOptions{})
+	assert.NotNil(t, err, "nested transaction")
+
+	stmt, err := conn.Prepare("INSERT INTO users (name) VALUES (?)")
+	if !assert.Nil(t, err) {
+		return
+	}
+	result, err := stmt.(*Stmt).ExecContext(context.Background(), []driver.NamedValue{{Ordinal: 1, Value: "kofj"}})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, pendingResult{}, result)
+	assert.Len(t, tx.(*Tx).stmts, 1)
+
+	stmt, err = conn.Prepare("INSERT INTO users (name) VALUES (?) RETURNING id")
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = stmt.(*Stmt).QueryContext(context.Background(), []driver.NamedValue{{Ordinal: 1, Value: "kofj"}})
+	assert.NotNil(t, err, "query writing within the transaction")
+	assert.Len(t, tx.(*Tx).stmts, 1, "nothing buffered")
+
+	assert.Nil(t, tx.Rollback())
+	assert.Nil(t, conn.tx)
+	assert.Empty(t, tx.(*Tx).stmts)
+}
+
+func TestParseSavepoint(t *testing.T) {
+	var tests = []struct {
+		query string
+		op    savepointOp
+		name  string
+		ok    bool
+	}{
+		{"SAVEPOINT sp1", opSavepoint, "sp1", true},
+		{"savepoint `sp1`;", opSavepoint, "sp1", true},
+		{"RELEASE SAVEPOINT sp1", opRelease, "sp1", true},
+		{"RELEASE sp1", opRelease, "sp1", true},
+		{"ROLLBACK TO SAVEPOINT sp1", opRollbackTo, "sp1", true},
+		{"ROLLBACK TRANSACTION TO \"sp1\"", opRollbackTo, "sp1", true},
+		{"ROLLBACK", 0, "", false},
+		{"ROLLBACK TRANSACTION", 0, "", false},
+		{"SELECT * FROM savepoints", 0, "", false},
+	}
+	for _, test := range tests {
+		op, name, ok := parseSavepoint(test.query)
+		assert.Equalf(t, test.ok, ok, test.query)
+		assert.Equalf(t, test.op, op, test.query)
+		assert.Equalf(t, test.name, name, test.query)
+	}
+}
+
+func TestBatchTxSavepoint(t *testing.T) {
+	connector := NewConnector("d1://account:token@00000000-0000-0000-0000-000000000000?verify=off&tx=batch")
+	dc, err := connector.Connect(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+	conn := dc.(*Conn)
+
+	exec := func(query string) error {
+		stmt, err := conn.Prepare(query)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.(*Stmt).ExecContext(context.Background(), nil)
+		return err
+	}
+
+	assert.ErrorIs(t, exec("SAVEPOINT sp1"), errSavepointOutsideTx)
+
+	tx, err := conn.BeginTx(context.Background(), driver.TxOptions{})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, exec("INSERT INTO users (name) VALUES ('a')"))
+	assert.Nil(t, exec("SAVEPOINT sp1"))
+	assert.Nil(t, exec("INSERT INTO users (name) VALUES ('b')"))
+	assert.Nil(t, exec("SAVEPOINT sp2"))
+	assert.Nil(t, exec("INSERT INTO users (name) VALUES ('c')"))
+	assert.Len(t, tx.(*Tx).stmts, 3)
+
+	assert.Nil(t, exec("ROLLBACK TO SAVEPOINT sp1"))
+	assert.Len(t, tx.(*Tx).stmts, 1)
+	assert.NotNil(t, exec("RELEASE SAVEPOINT sp2"), "released by rolling back to sp1")
+
+	assert.Nil(t, exec("INSERT INTO users (name) VALUES ('d')"))
+	assert.Nil(t, exec("ROLLBACK TO SAVEPOINT sp1"), "savepoint kept after rolling back to it")
+	assert.Len(t, tx.(*Tx).stmts, 1)
+	assert.Nil(t, exec("RELEASE SAVEPOINT sp1"))
+	assert.Empty(t, tx.(*Tx).savepoints)
+
+	assert.Nil(t, tx.Rollback())
+}
+
+func TestTxSavepointWithoutBatch(t *testing.T) {
+	connector := NewConnector("d1://account:token@00000000-0000-0000-0000-000000000000?verify=off&tx=none")
+	dc, err := connector.Connect(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+	conn := dc.(*Conn)
+
+	for _, query := range []string{"SAVEPOINT sp1", "ROLLBACK TO SAVEPOINT sp1", "RELEASE SAVEPOINT sp1"} {
+		stmt, err := conn.Prepare(query)
+		if !assert.Nil(t, err) {
+			continue
+		}
+		_, err = stmt.(*Stmt).ExecContext(context.Background(), nil)
+		assert.Nilf(t, err, "%s ignored", query)
+	}
+}
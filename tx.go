@@ -0,0 +1,44 @@
+package d1
+
+import (
+	"fmt"
+	"time"
+)
+
+// TransactionMode decides how statements within a database/sql
+// transaction are sent to D1, which has no interactive transactions.
+type TransactionMode string
+
+const (
+	// TransactionNone sends every statement right away, commit and
+	// rollback are no-ops.
+	TransactionNone TransactionMode = "none"
+	// TransactionBatch buffers the statements written within the
+	// transaction and sends them as one atomic batch on commit. Reads
+	// are sent right away and don't observe the buffered writes.
+	TransactionBatch TransactionMode = "batch"
+)
+
+func parseTransactionMode(s string) (TransactionMode, error) {
+	switch mode := TransactionMode(s); mode {
+	case TransactionNone, TransactionBatch:
+		return mode, nil
+	case "":
+		return TransactionNone, nil
+	default:
+		return "", fmt.Errorf("invalid tx mode specified: %s", s)
+	}
+}
+
+// TransactionMode returns the transaction mode set by the tx option.
+func (c *Connection) TransactionMode() TransactionMode {
+	return c.txMode
+}
+
+// TimeFormat returns the layout times are sent and parsed with.
+func (c *Connection) TimeFormat() string {
+	if c.timeFormat == "" {
+		return time.RFC3339Nano
+	}
+	return c.timeFormat
+}
@@ -0,0 +1,108 @@
+package d1
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// VerifyMode controls when the api token of a connection is verified.
+type VerifyMode string
+
+const (
+	// VerifyEager verifies the api token while opening the connection.
+	VerifyEager VerifyMode = "eager"
+	// VerifyLazy verifies the api token before the first statement is sent.
+	VerifyLazy VerifyMode = "lazy"
+	// VerifyOff never verifies the api token, errors surface on first use.
+	VerifyOff VerifyMode = "off"
+)
+
+const defaultVerifyTTLSecond = 300
+
+func parseVerifyMode(s string) (VerifyMode, error) {
+	switch mode := VerifyMode(s); mode {
+	case VerifyEager, VerifyLazy, VerifyOff:
+		return mode, nil
+	case "":
+		return VerifyEager, nil
+	default:
+		return "", fmt.Errorf("invalid verify mode specified: %s", s)
+	}
+}
+
+// verifyCache remembers successful token verifications process wide, so
+// pooled connections sharing a token don't verify it again and again.
+type verifyCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+var tokenVerifyCache = &verifyCache{entries: map[string]time.Time{}}
+
+func tokenHash(apiToken string) string {
+	sum := sha256.Sum256([]byte(apiToken))
+	return hex.EncodeToString(sum[:])
+}
+
+func (vc *verifyCache) valid(key string) bool {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	expires, ok := vc.entries[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(vc.entries, key)
+		return false
+	}
+	return true
+}
+
+func (vc *verifyCache) store(key string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.entries[key] = time.Now().Add(ttl)
+}
+
+// ResetVerifyCache forgets all cached token verifications.
+func ResetVerifyCache() {
+	tokenVerifyCache.mu.Lock()
+	defer tokenVerifyCache.mu.Unlock()
+	tokenVerifyCache.entries = map[string]time.Time{}
+}
+
+// ensureVerified verifies the api token once per connection, honoring the
+// verify mode of the connection and the process wide verification cache.
+func (c *Connection) ensureVerified(ctx context.Context) error {
+	if c.verifyMode == VerifyOff {
+		return nil
+	}
+
+	c.verifyMu.Lock()
+	defer c.verifyMu.Unlock()
+	if c.verified {
+		return nil
+	}
+
+	key := tokenHash(c.apiToken)
+	if tokenVerifyCache.valid(key) {
+		Trace("%s: api token verification cached", c.ID)
+		c.verified = true
+		return nil
+	}
+
+	if err := c.VerifyApiTokenContext(ctx); err != nil {
+		return err
+	}
+	tokenVerifyCache.store(key, c.verifyTTL)
+	c.verified = true
+	return nil
+}
@@ -0,0 +1,53 @@
+package d1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVerifyMode(t *testing.T) {
+	for input, expected := range map[string]VerifyMode{
+		"":      VerifyEager,
+		"eager": VerifyEager,
+		"lazy":  VerifyLazy,
+		"off":   VerifyOff,
+	} {
+		mode, err := parseVerifyMode(input)
+		assert.Nilf(t, err, "parse %q", input)
+		assert.Equalf(t, expected, mode, "parse %q", input)
+	}
+
+	_, err := parseVerifyMode("sometimes")
+	assert.NotNil(t, err)
+}
+
+func TestVerifyCache(t *testing.T) {
+	ResetVerifyCache()
+	key := tokenHash("token")
+	assert.False(t, tokenVerifyCache.valid(key))
+
+	tokenVerifyCache.store(key, 0)
+	assert.False(t, tokenVerifyCache.valid(key), "zero ttl disables cache")
+
+	tokenVerifyCache.store(key, time.Minute)
+	assert.True(t, tokenVerifyCache.valid(key))
+
+	tokenVerifyCache.store(key, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.False(t, tokenVerifyCache.valid(key), "expired")
+}
+
+func TestOpenWithoutVerify(t *testing.T) {
+	conn, err := Open("d1://account:token@00000000-0000-0000-0000-000000000000?verify=off")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, VerifyOff, conn.verifyMode)
+	assert.Nil(t, conn.ensureVerified(context.Background()))
+
+	_, err = Open("d1://account:token@00000000-0000-0000-0000-000000000000?verify=maybe")
+	assert.NotNil(t, err)
+}